@@ -0,0 +1,84 @@
+package goa
+
+import (
+	"net/http"
+)
+
+// WrapHandler wraps a http.Handler as a Middleware,
+// the handler responds the request so the downstream won't be run.
+func WrapHandler(h http.Handler) Middleware {
+	return func(c *Context) {
+		c.Handled = true
+		h.ServeHTTP(c.ResponseWriter, c.Request)
+	}
+}
+
+// WrapHTTPMiddleware wraps a net/http middleware as a Middleware.
+// The next handler of mw runs the downstream with the http.ResponseWriter
+// and *http.Request passed by mw, and responds through them,
+// errors and panics of the downstream included, so mw sees the final status.
+// If mw doesn't call the next handler, e.g. authentication failed,
+// the response written by mw is kept.
+func WrapHTTPMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(c *Context) {
+		w, r, u, p := c.ResponseWriter, c.Request, c.URL, c.Path
+		defer func() {
+			c.ResponseWriter, c.Request, c.URL, c.Path = w, r, u, p
+		}()
+
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.ResponseWriter, c.Request = w, r
+			if r.URL != c.URL {
+				c.URL = r.URL
+				c.Path = r.URL.Path
+			}
+
+			if err := c.nextRecovered(); err != nil {
+				c.app.handleError(c, err)
+			} else if !c.redirected && !c.Handled {
+				c.app.handleResponse(c)
+			}
+			// the downstream has been responded, don't propagate its error upstream
+			c.nextErr = nil
+		})).ServeHTTP(w, r)
+
+		c.Handled = true
+	}
+}
+
+// AsMiddleware returns the app as a net/http middleware.
+// When the last middleware of app calls c.Next(), the next handler runs.
+func (app *Goa) AsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		tail := chain{errMiddlewares: []ErrMiddleware{func(c *Context) error {
+			c.Handled = true
+			next.ServeHTTP(c.ResponseWriter, c.Request)
+			return nil
+		}}}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.middlewares.len() == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := app.pool.Get().(*Context)
+			c.init(w, r)
+			c.frames = append(c.frames, frame{tail, -1, c.Path})
+
+			app.handleRequest(c)
+
+			app.release(c)
+		})
+	}
+}
+
+// nextRecovered calls c.Next() and returns the panic of the downstream as an error.
+func (c *Context) nextRecovered() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = recovered(v)
+		}
+	}()
+	return c.Next()
+}
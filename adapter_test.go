@@ -0,0 +1,161 @@
+package goa
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey string
+
+func TestWrapHandler(t *testing.T) {
+	app := New()
+	app.Use(WrapHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("handler"))
+	})))
+	app.Use(func(c *Context) {
+		c.String("unreachable")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "handler", string(body))
+}
+
+func TestWrapHTTPMiddleware(t *testing.T) {
+	calls := []string{}
+	app := New()
+	app.Use(WrapHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "before")
+			w.Header().Set("X-Wrapped", "1")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey("user"), "goa")))
+			calls = append(calls, "after")
+		})
+	}))
+	app.Use(func(c *Context) {
+		calls = append(calls, "handler")
+		c.String(c.Request.Context().Value(ctxKey("user")).(string))
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, "goa", string(body))
+	assert.Equal(t, "1", resp.Header.Get("X-Wrapped"))
+	assert.Equal(t, []string{"before", "handler", "after"}, calls)
+}
+
+func TestWrapHTTPMiddlewareAbort(t *testing.T) {
+	app := New()
+	app.Use(WrapHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		})
+	}))
+	app.Use(func(c *Context) {
+		c.String("unreachable")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "unauthorized\n", string(body))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestWrapHTTPMiddlewareError(t *testing.T) {
+	var statuses []int
+	app := New()
+	app.Use(WrapHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			statuses = append(statuses, rec.status)
+		})
+	}))
+	app.UseErr(func(c *Context) error {
+		if c.Path == "/panic" {
+			c.Error(http.StatusNotFound, "not found")
+		}
+		return Error{Code: http.StatusForbidden, Msg: "forbidden"}
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	for path, expected := range map[string]string{"/": "forbidden", "/panic": "not found"} {
+		resp, err := http.Get(ts.URL + path)
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, expected, string(body))
+	}
+	assert.ElementsMatch(t, []int{http.StatusForbidden, http.StatusNotFound}, statuses)
+}
+
+func TestAsMiddleware(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.SetHeader("X-Goa", "1")
+		if c.Path == "/goa" {
+			c.String("goa")
+			return
+		}
+		c.Next()
+	})
+	handler := app.AsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for path, expected := range map[string]string{"/goa": "goa", "/": "next"} {
+		resp, err := http.Get(ts.URL + path)
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, expected, string(body))
+		assert.Equal(t, "1", resp.Header.Get("X-Goa"))
+	}
+}
+
+func TestEmptyAsMiddleware(t *testing.T) {
+	handler := New().AsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, "next", w.Body.String())
+}
@@ -27,6 +27,63 @@ func BenchmarkGoaMiddleware(b *testing.B) {
 	run(b, app)
 }
 
+func BenchmarkGoaManyMiddlewares(b *testing.B) {
+	app := New()
+	for i := 0; i < 200; i++ {
+		app.Use(func(c *Context) {
+			c.Next()
+		})
+	}
+
+	run(b, app)
+}
+
+func BenchmarkGoaErrMiddleware(b *testing.B) {
+	app := New()
+	app.UseErr(func(c *Context) error {
+		return c.Next()
+	})
+	app.UseErr(func(c *Context) error {
+		return c.Next()
+	})
+	app.UseErr(func(c *Context) error {
+		return c.Next()
+	})
+
+	run(b, app)
+}
+
+func BenchmarkGoaCompose(b *testing.B) {
+	app := New()
+	app.Use(Compose(
+		func(c *Context) {
+			c.Next()
+		},
+		func(c *Context) {
+			c.Next()
+		},
+	))
+	app.Use(func(c *Context) {
+		c.Next()
+	})
+
+	run(b, app)
+}
+
+func BenchmarkGoaMount(b *testing.B) {
+	child := New()
+	child.Use(func(c *Context) {
+		c.Next()
+	})
+	app := New()
+	app.Mount("/", child)
+	app.Use(func(c *Context) {
+		c.Next()
+	})
+
+	run(b, app)
+}
+
 func BenchmarkGoaString(b *testing.B) {
 	app := New()
 	app.Use(func(c *Context) {
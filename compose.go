@@ -0,0 +1,90 @@
+package goa
+
+import (
+	"path"
+	"strings"
+)
+
+// Compose composes the middlewares into a single Middleware.
+// c.Next() in the last of them continues the downstream of the composed one.
+func Compose(middlewares ...Middleware) Middleware {
+	var handlers chain
+	for _, m := range middlewares {
+		handlers.use(m, nil)
+	}
+
+	return func(c *Context) {
+		if handlers.len() == 0 {
+			c.Next()
+			return
+		}
+		c.nextErr = c.run(handlers, c.Path)
+	}
+}
+
+// When uses m only if cond returns true, otherwise skips to the next middleware.
+func When(m Middleware, cond func(*Context) bool) Middleware {
+	return func(c *Context) {
+		if cond(c) {
+			m(c)
+		} else {
+			c.Next()
+		}
+	}
+}
+
+// Unless skips m if c.Path matches one of the patterns.
+// The pattern syntax is the same as path.Match, and a "**" segment matches any number of segments,
+// e.g. "/static/*" matches "/static/app.js", "/static/**" matches "/static/js/app.js" as well.
+func Unless(m Middleware, patterns ...string) Middleware {
+	return When(m, func(c *Context) bool {
+		for _, pattern := range patterns {
+			if matchPath(pattern, c.Path) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// matchPath reports whether p matches the pattern of Unless.
+func matchPath(pattern, p string) bool {
+	if !strings.Contains(pattern, "**") {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// ForMethods uses m only for the HTTP methods.
+func ForMethods(m Middleware, methods ...string) Middleware {
+	return When(m, func(c *Context) bool {
+		for _, method := range methods {
+			if c.Method == method {
+				return true
+			}
+		}
+		return false
+	})
+}
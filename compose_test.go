@@ -0,0 +1,157 @@
+package goa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func record(calls *[]string, name string) Middleware {
+	return func(c *Context) {
+		*calls = append(*calls, name)
+		c.Next()
+	}
+}
+
+func request(t *testing.T, app *Goa, method, path string) string {
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(method, ts.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestCompose(t *testing.T) {
+	calls := []string{}
+	app := New()
+	app.Use(Compose(
+		func(c *Context) {
+			calls = append(calls, "1")
+			c.Next()
+			calls = append(calls, "4")
+		},
+		func(c *Context) {
+			calls = append(calls, "2")
+			c.Next()
+			calls = append(calls, "3")
+		},
+	))
+	app.Use(func(c *Context) {
+		calls = append(calls, "downstream")
+		c.String("composed")
+	})
+
+	assert.Equal(t, "composed", request(t, app, "GET", "/"))
+	assert.Equal(t, []string{"1", "2", "downstream", "3", "4"}, calls)
+}
+
+func TestComposeEmpty(t *testing.T) {
+	app := New()
+	app.Use(Compose())
+	app.Use(func(c *Context) {
+		c.String("empty")
+	})
+
+	assert.Equal(t, "empty", request(t, app, "GET", "/"))
+}
+
+func TestComposeError(t *testing.T) {
+	app := New()
+	app.Use(Compose(func(c *Context) {
+		c.Next()
+	}))
+	app.UseErr(func(c *Context) error {
+		return Error{Code: 400, Msg: "composed error"}
+	})
+
+	assert.Equal(t, "composed error", request(t, app, "GET", "/"))
+}
+
+func TestComposeNextTwice(t *testing.T) {
+	calls := 0
+	app := New()
+	app.Use(Compose(func(c *Context) {
+		c.Next()
+		assert.Nil(t, c.Next())
+	}))
+	app.Use(func(c *Context) {
+		calls++
+		c.String("composed")
+	})
+
+	assert.Equal(t, "composed", request(t, app, "GET", "/"))
+	assert.Equal(t, 1, calls)
+}
+
+func TestWhen(t *testing.T) {
+	calls := []string{}
+	app := New()
+	app.Use(When(record(&calls, "when"), func(c *Context) bool {
+		return c.Query("debug") == "1"
+	}))
+	app.Use(func(c *Context) {
+		c.String("ok")
+	})
+
+	request(t, app, "GET", "/?debug=1")
+	request(t, app, "GET", "/")
+	assert.Equal(t, []string{"when"}, calls)
+}
+
+func TestUnless(t *testing.T) {
+	calls := []string{}
+	app := New()
+	app.Use(Unless(record(&calls, "auth"), "/public/*", "/login"))
+	app.Use(func(c *Context) {
+		calls = append(calls, c.Path)
+	})
+
+	request(t, app, "GET", "/public/a.js")
+	request(t, app, "GET", "/login")
+	request(t, app, "GET", "/admin")
+	assert.Equal(t, []string{"/public/a.js", "/login", "auth", "/admin"}, calls)
+
+	// "*" doesn't match a nested path, "**" does
+	calls = calls[:0]
+	app = New()
+	app.Use(Unless(record(&calls, "auth"), "/public/*", "/static/**"))
+	app.Use(func(c *Context) {
+		calls = append(calls, c.Path)
+	})
+
+	request(t, app, "GET", "/public/js/a.js")
+	request(t, app, "GET", "/static/js/app.js")
+	request(t, app, "GET", "/static")
+	request(t, app, "GET", "/statics/app.js")
+	assert.Equal(t, []string{"auth", "/public/js/a.js", "/static/js/app.js", "/static", "auth", "/statics/app.js"}, calls)
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/static/**", "/static/js/app.js"))
+	assert.True(t, matchPath("/static/**", "/static/"))
+	assert.True(t, matchPath("/**/*.js", "/static/js/app.js"))
+	assert.True(t, matchPath("/api/**/edit", "/api/users/1/edit"))
+	assert.False(t, matchPath("/api/**/edit", "/api/users/1"))
+	assert.False(t, matchPath("/static/*", "/static/js/app.js"))
+}
+
+func TestForMethods(t *testing.T) {
+	calls := []string{}
+	app := New()
+	app.Use(ForMethods(record(&calls, "csrf"), "POST", "PUT"))
+	app.Use(func(c *Context) {
+		calls = append(calls, strings.ToLower(c.Method))
+	})
+
+	request(t, app, "GET", "/")
+	request(t, app, "POST", "/")
+	assert.Equal(t, []string{"get", "csrf", "post"}, calls)
+}
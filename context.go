@@ -1,10 +1,14 @@
 package goa
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/goa-go/goa/parser"
 	"github.com/goa-go/goa/responser"
@@ -35,6 +39,9 @@ type Context struct {
 	Params   Params
 	Keys     map[string]interface{}
 
+	// values of the typed keys
+	values map[interface{}]interface{}
+
 	status         int
 	explicitStatus bool
 
@@ -45,16 +52,30 @@ type Context struct {
 	Handled    bool
 	redirected bool
 
-	index int8
-	len   int8
-	app   *Goa
+	handlers chain
+	index    int
+	app      *Goa
+	nextErr  error
+	frames   []frame
+	released bool
+
+	// event stream started by c.SSE()
+	stream *EventStream
+
+	// hooks added by c.OnFinish()
+	finishers []func() error
 
 	responser responser.Responser
+	// whether the responser is responded, which closes its body
+	responded bool
+
+	writer responseWriter
 }
 
 func (c *Context) init(w http.ResponseWriter, r *http.Request) {
 	c.Request = r
-	c.ResponseWriter = w
+	c.writer.reset(w)
+	c.ResponseWriter = &c.writer
 	c.Method = r.Method
 	c.URL = r.URL
 	c.Path = r.URL.Path
@@ -64,32 +85,110 @@ func (c *Context) init(w http.ResponseWriter, r *http.Request) {
 
 	c.Params = nil
 	c.Keys = nil
+	c.values = nil
 	c.queryMap = nil
 	c.ct = ""
 	c.Handled = false
 	c.redirected = false
 	c.responser = nil
-	c.index = 0
-	c.len = int8(len(c.app.middlewares))
+	c.responded = false
+	c.stream = nil
+	for i := range c.finishers {
+		c.finishers[i] = nil
+	}
+	c.finishers = c.finishers[:0]
+	c.handlers = c.app.middlewares
+	c.index = -1
+	c.nextErr = nil
+	c.frames = c.frames[:0]
 }
 
-// Next implements the next middleware.
+// Next implements the next middleware,
+// and returns the error returned by the downstream.
 // For example,
 // app.Use(func(c *goa.Context) {
 //   //do sth
 //   c.Next()
 //   //do sth
 // })
-func (c *Context) Next() {
-	if c.index >= c.len-1 {
-		return
+func (c *Context) Next() error {
+	c.checkReleased()
+	if c.index >= c.handlers.len()-1 {
+		// the index is past the end once the outer chain has been resumed
+		if c.index < c.handlers.len() && len(c.frames) > 0 {
+			return c.resume()
+		}
+		return nil
 	}
 	c.index++
-	c.app.middlewares[c.index](c)
+	if e := c.handlers.errMiddlewares[c.index]; e != nil {
+		c.nextErr = e(c)
+		return c.nextErr
+	}
+	// since a Middleware can't return, the error returned by c.Next() in it keeps propagating
+	c.nextErr = nil
+	c.handlers.middlewares[c.index](c)
+	return c.nextErr
+}
+
+// frame is the state of a middleware chain, saved while a nested chain runs.
+type frame struct {
+	handlers chain
+	index    int
+	path     string
+}
+
+func (c *Context) frame() frame {
+	return frame{c.handlers, c.index, c.Path}
+}
+
+func (c *Context) restore(f frame) {
+	c.handlers, c.index, c.Path = f.handlers, f.index, f.path
+}
+
+// Run runs the handlers as a nested middleware chain,
+// c.Next() in the last handler continues the downstream of the current middleware.
+// Routers can run the middlewares of the matched route by it,
+// it doesn't allocate once the handlers are prepared.
+func (c *Context) Run(handlers []ErrMiddleware) error {
+	if len(handlers) == 0 {
+		return c.Next()
+	}
+	return c.run(chain{errMiddlewares: handlers}, c.Path)
+}
+
+// run runs the nested chain of handlers with the path,
+// the current chain is restored when it returns.
+func (c *Context) run(handlers chain, path string) error {
+	c.frames = append(c.frames, c.frame())
+	defer func() {
+		c.restore(c.frames[len(c.frames)-1])
+		c.frames = c.frames[:len(c.frames)-1]
+	}()
+
+	c.restore(frame{handlers, -1, path})
+	return c.Next()
+}
+
+// resume continues the downstream of the outer chain,
+// when the nested chain calls c.Next() after its last middleware.
+func (c *Context) resume() error {
+	parent := c.frames[len(c.frames)-1]
+	current := c.frame()
+	c.frames = c.frames[:len(c.frames)-1]
+	defer func() {
+		c.frames = append(c.frames, parent)
+		current.index++
+		c.restore(current)
+	}()
+
+	c.restore(parent)
+	return c.Next()
 }
 
 // Set value.
 func (c *Context) Set(key string, value interface{}) {
+	c.checkReleased()
 	if c.Keys == nil {
 		c.Keys = make(map[string]interface{})
 	}
@@ -98,10 +197,74 @@ func (c *Context) Set(key string, value interface{}) {
 
 // Get value, return (value, exists).
 func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.checkReleased()
 	value, exists = c.Keys[key]
 	return
 }
 
+/* context.Context */
+
+// Deadline returns the deadline of the request context.
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	c.checkReleased()
+	if c.Request == nil {
+		return
+	}
+	return c.Request.Context().Deadline()
+}
+
+// Done returns the done channel of the request context,
+// it's closed when the client disconnects or the deadline exceeds.
+func (c *Context) Done() <-chan struct{} {
+	c.checkReleased()
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Done()
+}
+
+// Err returns the error of the request context.
+func (c *Context) Err() error {
+	c.checkReleased()
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Err()
+}
+
+// Value returns the value of c.Keys if key is a string and exists,
+// the value of a typed key if key is a *goa.Key,
+// otherwise the value of the request context.
+func (c *Context) Value(key interface{}) interface{} {
+	c.checkReleased()
+	if k, ok := key.(string); ok {
+		if value, exists := c.Keys[k]; exists {
+			return value
+		}
+	} else if value, exists := c.values[key]; exists {
+		return value
+	}
+	if c.Request == nil {
+		return nil
+	}
+	return c.Request.Context().Value(key)
+}
+
+// WithTimeout sets the timeout of the request context,
+// c.Request is replaced by a copy with the new context.
+// The returned cancel releases resources and puts back the previous c.Request,
+// so the timeout only applies until it's called, e.g.
+// defer c.WithTimeout(time.Second)()
+func (c *Context) WithTimeout(d time.Duration) context.CancelFunc {
+	req := c.Request
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	c.Request = req.WithContext(ctx)
+	return func() {
+		cancel()
+		c.Request = req
+	}
+}
+
 /* handle request */
 
 // Query returns the keyed url query value or ""
@@ -123,6 +286,7 @@ func (c *Context) GetQuery(key string) (string, bool) {
 // GetQueryArray returns a slice of value for a given query key.
 // And returns whether at least one value exists for the given key.
 func (c *Context) GetQueryArray(key string) ([]string, bool) {
+	c.checkReleased()
 	c.initQuery()
 	if querys, ok := c.queryMap[key]; ok && len(querys) > 0 {
 		return querys, true
@@ -150,6 +314,7 @@ func (c *Context) FormFile(name string) (multipart.File, *multipart.FileHeader,
 // Param returns the value of the URL param or "".
 // When using goa-router, it works.
 func (c *Context) Param(key string) string {
+	c.checkReleased()
 	return c.Params.Get(key)
 }
 
@@ -165,6 +330,7 @@ func (ps Params) Get(name string) string {
 }
 
 func (c *Context) parse(p parser.Parser) error {
+	c.checkReleased()
 	return p.Parse(c.Request)
 }
 
@@ -228,6 +394,7 @@ func (c *Context) Cookie(name string) (string, error) {
 
 // Status sets the HTTP response code.
 func (c *Context) Status(code int) {
+	c.checkReleased()
 	if code < 100 || code > 999 {
 		panic(fmt.Errorf("invalid status code: %d", code))
 	}
@@ -250,42 +417,183 @@ func (c *Context) respond(r responser.Responser) error {
 
 // JSON responds json-data.
 func (c *Context) JSON(json interface{}) {
+	c.checkReleased()
 	if !c.explicitStatus {
 		c.Status(http.StatusOK)
 	}
 
 	c.ct = "application/json; charset=utf-8"
-	c.responser = responser.JSON{Data: json}
+	c.setResponser(responser.JSON{Data: json})
 }
 
 // XML responds xml-data.
 func (c *Context) XML(xml interface{}) {
+	c.checkReleased()
 	if !c.explicitStatus {
 		c.Status(http.StatusOK)
 	}
 
 	c.ct = "application/xml; charset=utf-8"
-	c.responser = responser.XML{Data: xml}
+	c.setResponser(responser.XML{Data: xml})
 }
 
 // String responds string-data.
 func (c *Context) String(str string) {
+	c.checkReleased()
 	if !c.explicitStatus {
 		c.Status(http.StatusOK)
 	}
 
 	c.ct = "text/plain; charset=utf-8"
-	c.responser = responser.String{Data: str}
+	c.setResponser(responser.String{Data: str})
 }
 
 // HTML responds html.
 func (c *Context) HTML(html string) {
+	c.checkReleased()
 	if !c.explicitStatus {
 		c.Status(http.StatusOK)
 	}
 
 	c.ct = "text/html; charset=utf-8"
-	c.responser = responser.String{Data: html}
+	c.setResponser(responser.String{Data: html})
+}
+
+// NDJSON responds the elements of a channel or iterator as newline-delimited json,
+// see responser.NDJSON, the stream stops when the request is canceled.
+// For example,
+// c.NDJSON(rows) // rows is a <-chan Row
+func (c *Context) NDJSON(data interface{}) {
+	c.checkReleased()
+	if !c.explicitStatus {
+		c.Status(http.StatusOK)
+	}
+
+	c.ct = "application/x-ndjson"
+	c.setResponser(responser.NDJSON{Context: c.Request.Context(), Data: data})
+}
+
+// JSONArray responds the elements of a channel or iterator as a streaming json array,
+// see responser.JSONArray, the stream stops when the request is canceled.
+func (c *Context) JSONArray(data interface{}) {
+	c.checkReleased()
+	if !c.explicitStatus {
+		c.Status(http.StatusOK)
+	}
+
+	c.ct = "application/json; charset=utf-8"
+	c.setResponser(responser.JSONArray{Context: c.Request.Context(), Data: data})
+}
+
+// Body returns the response body set by c.JSON, c.String, c.SetBody, etc.
+// Upstream middlewares can inspect it after c.Next() returns.
+// It's the data of the built-in responsers, or the custom responser itself.
+func (c *Context) Body() interface{} {
+	c.checkReleased()
+	switch r := c.responser.(type) {
+	case responser.String:
+		return r.Data
+	case responser.JSON:
+		return r.Data
+	case responser.XML:
+		return r.Data
+	case responser.Bytes:
+		return r.Data
+	case responser.Reader:
+		return r.Data
+	case responser.NDJSON:
+		return r.Data
+	case responser.JSONArray:
+		return r.Data
+	default:
+		return r
+	}
+}
+
+// SetBody sets the response body, the responser is chosen by its type like koa.
+// string is responded as text/plain, []byte and io.Reader as application/octet-stream,
+// unless Content-Type has been set.
+// Any other value is responded as JSON, and nil removes the body.
+func (c *Context) SetBody(body interface{}) {
+	c.checkReleased()
+	var r responser.Responser
+	ct := ""
+
+	switch b := body.(type) {
+	case nil:
+		c.setResponser(nil)
+		return
+	case string:
+		r = responser.String{Data: b}
+		ct = "text/plain; charset=utf-8"
+	case []byte:
+		r = responser.Bytes{Data: b}
+		ct = "application/octet-stream"
+	case io.Reader:
+		r = responser.Reader{Data: b}
+		ct = "application/octet-stream"
+	default:
+		// JSON always overrides Content-Type like koa.
+		r = responser.JSON{Data: b}
+		c.ct = "application/json; charset=utf-8"
+	}
+
+	if !c.explicitStatus {
+		c.Status(http.StatusOK)
+	}
+	if c.ct == "" {
+		c.ct = ct
+	}
+	c.setResponser(r)
+}
+
+// ContentType returns the Content-Type of the response body.
+func (c *Context) ContentType() string {
+	c.checkReleased()
+	return c.ct
+}
+
+// SetContentType sets the Content-Type of the response body.
+func (c *Context) SetContentType(ct string) {
+	c.checkReleased()
+	c.ct = ct
+}
+
+// Responser returns the responser of the response body.
+func (c *Context) Responser() responser.Responser {
+	c.checkReleased()
+	return c.responser
+}
+
+// SetResponser sets the responser of the response body.
+func (c *Context) SetResponser(r responser.Responser) {
+	c.checkReleased()
+	if !c.explicitStatus {
+		c.Status(http.StatusOK)
+	}
+	c.setResponser(r)
+}
+
+// setResponser replaces the responser, the body of the replaced one is closed
+// if it's an io.Closer, e.g. the file of c.File.
+func (c *Context) setResponser(r responser.Responser) {
+	if closer := bodyCloser(c.responser); closer != nil && closer != bodyCloser(r) {
+		closer.Close()
+	}
+	c.responser = r
+}
+
+// bodyCloser returns the body of the responser if it's an io.Closer.
+func bodyCloser(r responser.Responser) io.Closer {
+	var body interface{}
+	switch r := r.(type) {
+	case responser.Content:
+		body = r.Data
+	case responser.Reader:
+		body = r.Data
+	}
+	closer, _ := body.(io.Closer)
+	return closer
 }
 
 // Redirect replies to the request with a redirect to url and a status code.
@@ -298,12 +606,56 @@ func (c *Context) Redirect(code int, url string) {
 	http.Redirect(c.ResponseWriter, c.Request, url, code)
 }
 
+// OnFinish adds a hook which is called after the response is written,
+// even if a middleware has replaced c.ResponseWriter again, e.g. to close a ResponseWriter
+// wrapped by the middleware. The hooks are called in reverse order, errors are logged.
+// For example,
+// cw := newCompressWriter(c.ResponseWriter)
+// c.ResponseWriter = cw
+// c.OnFinish(cw.Close)
+func (c *Context) OnFinish(f func() error) {
+	c.checkReleased()
+	c.finishers = append(c.finishers, f)
+}
+
+// Response returns the ResponseWriter wrapped by goa,
+// or c.ResponseWriter if a middleware replaces it with a ResponseWriter wrapping the former one.
+func (c *Context) Response() ResponseWriter {
+	if w, ok := c.ResponseWriter.(ResponseWriter); ok {
+		return w
+	}
+	return &c.writer
+}
+
+// written reports whether the response has been written, c.Response().Written() for short.
+func (c *Context) written() bool {
+	// the common case doesn't need an interface assertion
+	if c.ResponseWriter == http.ResponseWriter(&c.writer) {
+		return c.writer.Written()
+	}
+	return c.Response().Written()
+}
+
 // SetHeader sets http response header.
-// It should be called before Status and Respond.
+// It should be called before the headers are sent,
+// otherwise it does nothing but logs a warning.
 func (c *Context) SetHeader(key string, value string) {
+	c.checkReleased()
+	if w, ok := c.ResponseWriter.(ResponseWriter); ok && w.Committed() {
+		c.logf("[WARN] goa: header %s is set after the headers are sent", key)
+		return
+	}
 	c.ResponseWriter.Header().Set(key, value)
 }
 
+func (c *Context) logf(format string, args ...interface{}) {
+	if c.app != nil {
+		c.app.logf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
 func (c *Context) writeContentType(value string) {
 	header := c.ResponseWriter.Header()
 	if val := header["Content-Type"]; len(val) == 0 {
@@ -316,17 +668,28 @@ func (c *Context) SetCookie(cookie *http.Cookie) {
 	http.SetCookie(c.ResponseWriter, cookie)
 }
 
-// Error is used like c.Error(goa.Error{...}).
-// It will create a http-error.
-type Error struct {
-	Code int
-	Msg  string
-}
-
 // Error throw a http-error, it would be catched by goa.
 func (c *Context) Error(code int, msg string) {
 	panic(Error{
-		code,
-		msg,
+		Code: code,
+		Msg:  msg,
 	})
 }
+
+// Throw throws err as a http-error with the code, err is kept as the cause.
+func (c *Context) Throw(err error, code int) {
+	panic(Error{
+		Code:  code,
+		Msg:   err.Error(),
+		Cause: err,
+	})
+}
+
+// Assert throws a http-error with the code and msg if cond is false.
+// For example,
+// c.Assert(user != nil, 401, "please login")
+func (c *Context) Assert(cond bool, code int, msg string) {
+	if !cond {
+		c.Error(code, msg)
+	}
+}
@@ -2,12 +2,16 @@ package goa
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/goa-go/goa/responser"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -248,6 +252,58 @@ func TestRespondHTML(t *testing.T) {
 	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
 }
 
+func TestRespondNDJSON(t *testing.T) {
+	ch := make(chan int, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	c := &Context{Request: httptest.NewRequest("GET", "/", nil)}
+	w := httptest.NewRecorder()
+	c.ResponseWriter = w
+	c.NDJSON(ch)
+	c.writeContentType(c.ct)
+	c.ResponseWriter.WriteHeader(c.status)
+	c.respond(c.responser)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1\n2\n", w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+}
+
+func TestRespondJSONArray(t *testing.T) {
+	ch := make(chan int, 2)
+	ch <- 1
+	ch <- 2
+	close(ch)
+
+	c := &Context{Request: httptest.NewRequest("GET", "/", nil)}
+	w := httptest.NewRecorder()
+	c.ResponseWriter = w
+	c.JSONArray(ch)
+	c.writeContentType(c.ct)
+	c.ResponseWriter.WriteHeader(c.status)
+	c.respond(c.responser)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[1,2]\n", w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestRespondStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the channel never sends, the stream stops with the request
+	c := &Context{Request: httptest.NewRequest("GET", "/", nil).WithContext(ctx)}
+	c.ResponseWriter = httptest.NewRecorder()
+	c.NDJSON(make(chan int))
+	assert.Equal(t, context.Canceled, c.respond(c.responser))
+
+	c.JSONArray(make(chan int))
+	assert.Equal(t, context.Canceled, c.respond(c.responser))
+}
+
 func TestRespondWithCustomStatus(t *testing.T) {
 	c := &Context{}
 	w := httptest.NewRecorder()
@@ -308,3 +364,116 @@ func TestContextError(t *testing.T) {
 
 	c.Error(500, http.StatusText(500))
 }
+
+func TestThrow(t *testing.T) {
+	c := &Context{}
+	cause := errors.New("cause")
+
+	defer func() {
+		err := recover()
+		assert.Equal(t, Error{
+			Code:  400,
+			Msg:   "cause",
+			Cause: cause,
+		}, err.(Error))
+	}()
+
+	c.Throw(cause, 400)
+}
+
+func TestAssert(t *testing.T) {
+	c := &Context{}
+	assert.NotPanics(t, func() { c.Assert(true, 401, "please login") })
+
+	defer func() {
+		err := recover()
+		assert.Equal(t, Error{
+			Code: 401,
+			Msg:  "please login",
+		}, err.(Error))
+	}()
+
+	c.Assert(false, 401, "please login")
+}
+
+var _ context.Context = &Context{}
+
+type contextKey string
+
+func TestContextValue(t *testing.T) {
+	c := &Context{}
+	assert.Nil(t, c.Value("key"))
+	assert.Nil(t, c.Done())
+	assert.Nil(t, c.Err())
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	c.Request = req.WithContext(context.WithValue(req.Context(), contextKey("user"), "goa"))
+	c.Set("key", "value")
+
+	assert.Equal(t, "value", c.Value("key"))
+	assert.Equal(t, "goa", c.Value(contextKey("user")))
+	assert.Nil(t, c.Value("user"))
+}
+
+func TestContextWithTimeout(t *testing.T) {
+	c := &Context{}
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	_, ok := c.Deadline()
+	assert.False(t, ok)
+
+	cancel := c.WithTimeout(10 * time.Millisecond)
+	_, ok = c.Deadline()
+	assert.True(t, ok)
+
+	select {
+	case <-c.Done():
+		assert.Equal(t, context.DeadlineExceeded, c.Err())
+	case <-time.After(time.Second):
+		t.Fatal("deadline was not exceeded")
+	}
+
+	cancel()
+	_, ok = c.Deadline()
+	assert.False(t, ok)
+	assert.Nil(t, c.Err())
+}
+
+func TestSetBody(t *testing.T) {
+	c := &Context{}
+	c.SetBody("string")
+	assert.Equal(t, "string", c.Body())
+	assert.Equal(t, "text/plain; charset=utf-8", c.ContentType())
+	assert.Equal(t, responser.String{Data: "string"}, c.Responser())
+	assert.Equal(t, http.StatusOK, c.GetStatus())
+
+	c = &Context{}
+	c.SetContentType("image/png")
+	c.SetBody([]byte("png"))
+	assert.Equal(t, "image/png", c.ContentType())
+	assert.Equal(t, responser.Bytes{Data: []byte("png")}, c.Responser())
+
+	c = &Context{}
+	r := strings.NewReader("reader")
+	c.SetBody(r)
+	assert.Equal(t, "application/octet-stream", c.ContentType())
+	assert.Equal(t, responser.Reader{Data: r}, c.Responser())
+
+	c.SetBody(M{"key": "value"})
+	assert.Equal(t, "application/json; charset=utf-8", c.ContentType())
+	assert.Equal(t, M{"key": "value"}, c.Body())
+
+	c.SetBody(nil)
+	assert.Nil(t, c.Body())
+	assert.Nil(t, c.Responser())
+}
+
+func TestSetResponser(t *testing.T) {
+	c := &Context{}
+	c.Status(http.StatusCreated)
+	r := responser.XML{Data: obj{"value"}}
+	c.SetResponser(r)
+
+	assert.Equal(t, obj{"value"}, c.Body())
+	assert.Equal(t, r, c.Responser())
+	assert.Equal(t, http.StatusCreated, c.GetStatus())
+}
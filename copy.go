@@ -0,0 +1,115 @@
+package goa
+
+import (
+	"net/http"
+	"net/url"
+)
+
+const errReleased = "goa: Context is used after the request is handled, use c.Copy() in goroutines"
+
+// Copy returns a read-only snapshot of c, which is safe to be used in goroutines
+// after the request is handled, since c is reused for other requests.
+// Request, URL, Header, Params, Keys, the typed values and the query are copied.
+// The copy can't respond, its ResponseWriter is nil and c.Next() does nothing.
+// As a context.Context, it's still done when the request is finished.
+func (c *Context) Copy() *Context {
+	c.checkReleased()
+
+	cp := &Context{
+		Method:         c.Method,
+		Path:           c.Path,
+		status:         c.status,
+		explicitStatus: c.explicitStatus,
+		ct:             c.ct,
+		Handled:        true,
+		app:            c.app,
+	}
+
+	if c.Request != nil {
+		cp.Request = c.Request.WithContext(c.Request.Context())
+		cp.Header = cloneHeader(c.Request.Header)
+		cp.Request.Header = cp.Header
+		c.initQuery()
+		cp.queryMap = cloneValues(c.queryMap)
+	}
+	if c.URL != nil {
+		u := *c.URL
+		cp.URL = &u
+		if cp.Request != nil {
+			cp.Request.URL = cp.URL
+		}
+	}
+	if c.Params != nil {
+		cp.Params = make(Params, len(c.Params))
+		copy(cp.Params, c.Params)
+	}
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+	}
+	if c.values != nil {
+		cp.values = make(map[interface{}]interface{}, len(c.values))
+		for k, v := range c.values {
+			cp.values[k] = v
+		}
+	}
+	return cp
+}
+
+func cloneHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	return http.Header(cloneValues(url.Values(h)))
+}
+
+func cloneValues(values url.Values) url.Values {
+	if values == nil {
+		return nil
+	}
+	cp := make(url.Values, len(values))
+	for k, v := range values {
+		cp[k] = append([]string(nil), v...)
+	}
+	return cp
+}
+
+// release poisons c instead of putting it back to the pool in debug mode,
+// any later use of it panics.
+func (c *Context) release() {
+	c.released = true
+	c.Request = nil
+	c.ResponseWriter = releasedWriter{}
+	c.URL = nil
+	c.Header = nil
+	c.Params = nil
+	c.Keys = nil
+	c.values = nil
+	c.queryMap = nil
+	c.handlers = chain{}
+	c.frames = nil
+	c.finishers = nil
+}
+
+func (c *Context) checkReleased() {
+	if c.released {
+		panic(errReleased)
+	}
+}
+
+// releasedWriter is the ResponseWriter of a released Context.
+type releasedWriter struct{}
+
+func (releasedWriter) Header() http.Header {
+	panic(errReleased)
+}
+
+func (releasedWriter) Write([]byte) (int, error) {
+	panic(errReleased)
+}
+
+func (releasedWriter) WriteHeader(int) {
+	panic(errReleased)
+}
@@ -0,0 +1,92 @@
+package goa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	c := &Context{app: New()}
+	req, _ := http.NewRequest("GET", "/path?name=goa", nil)
+	req.Header.Set("X-Key", "value")
+	c.init(httptest.NewRecorder(), req)
+	c.Params = Params{{Key: "id", Value: "1"}}
+	c.Set("key", "value")
+
+	cp := c.Copy()
+	c.Request.Header.Set("X-Key", "changed")
+	c.Params[0].Value = "2"
+	c.Set("key", "changed")
+	c.queryMap.Set("name", "changed")
+
+	assert.Equal(t, "GET", cp.Method)
+	assert.Equal(t, "/path", cp.Path)
+	assert.Equal(t, "value", cp.Header.Get("X-Key"))
+	assert.Equal(t, "value", cp.Request.Header.Get("X-Key"))
+	assert.Equal(t, "1", cp.Param("id"))
+	assert.Equal(t, "goa", cp.Query("name"))
+	value, _ := cp.Get("key")
+	assert.Equal(t, "value", value)
+	assert.Nil(t, cp.ResponseWriter)
+	assert.Nil(t, cp.Next())
+}
+
+func TestCopyInGoroutines(t *testing.T) {
+	var wg sync.WaitGroup
+	results := make(chan [2]string, 100)
+	app := New()
+	app.Use(func(c *Context) {
+		c.Set("id", c.Query("id"))
+		cp := c.Copy()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, _ := cp.Get("id")
+			results <- [2]string{cp.Query("id"), id.(string)}
+		}()
+		c.String("ok")
+	})
+
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest("GET", "/?id="+strconv.Itoa(i), nil)
+		app.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	wg.Wait()
+	close(results)
+
+	for r := range results {
+		assert.Equal(t, r[0], r[1])
+	}
+}
+
+func TestDebugReleased(t *testing.T) {
+	var leaked *Context
+	app := New()
+	app.Debug = true
+	app.Use(func(c *Context) {
+		leaked = c
+		c.String("ok")
+	})
+	req, _ := http.NewRequest("GET", "/", nil)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.PanicsWithValue(t, errReleased, func() { leaked.Get("key") })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.Done() })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.Copy() })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.ResponseWriter.Write(nil) })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.JSON(M{}) })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.XML(M{}) })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.String("") })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.HTML("") })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.SetBody("") })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.SetResponser(nil) })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.Body() })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.Responser() })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.ContentType() })
+	assert.PanicsWithValue(t, errReleased, func() { leaked.SetContentType("") })
+}
@@ -0,0 +1,79 @@
+package goa
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error is used like c.Error(goa.Error{...}).
+// It will create a http-error.
+type Error struct {
+	Code int
+	Msg  string
+
+	// Expose shows Msg of a 5xx error to the client,
+	// otherwise the status text is responded.
+	// Msg of a 4xx error is always exposed.
+	Expose bool
+
+	// Header is the extra response headers, e.g. Retry-After.
+	Header http.Header
+
+	// Cause is the wrapped error, it works with errors.Is and errors.As.
+	Cause error
+
+	// Fields are the extra fields serialized into the error body.
+	Fields map[string]interface{}
+}
+
+// Error returns the message of the http-error.
+func (e Error) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns e.Cause.
+func (e Error) Unwrap() error {
+	return e.Cause
+}
+
+// Exposed reports whether Msg can be shown to the client.
+func (e Error) Exposed() bool {
+	return e.Expose || e.Code < http.StatusInternalServerError
+}
+
+// Message returns Msg if it's exposed, otherwise the status text.
+func (e Error) Message() string {
+	if e.Exposed() {
+		return e.Msg
+	}
+	return http.StatusText(e.Code)
+}
+
+// MarshalJSON serializes the code, the exposed message and Fields.
+func (e Error) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(e.Fields)+2)
+	for k, v := range e.Fields {
+		m[k] = v
+	}
+	m["code"] = e.Code
+	m["message"] = e.Message()
+	return json.Marshal(m)
+}
+
+// asError finds the first goa.Error in the chain of err.
+func asError(err error) (Error, bool) {
+	for err != nil {
+		if e, ok := err.(Error); ok {
+			return e, true
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		case interface{ Cause() error }:
+			err = x.Cause()
+		default:
+			return Error{}, false
+		}
+	}
+	return Error{}, false
+}
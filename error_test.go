@@ -0,0 +1,49 @@
+package goa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorUnwrap(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", Error{Code: 400, Msg: "bad", Cause: io.EOF})
+
+	assert.True(t, errors.Is(err, io.EOF))
+
+	var e Error
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, 400, e.Code)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "bad", Error{Code: 400, Msg: "bad"}.Message())
+	assert.Equal(t, "Internal Server Error", Error{Code: 500, Msg: "db down"}.Message())
+	assert.Equal(t, "db down", Error{Code: 500, Msg: "db down", Expose: true}.Message())
+}
+
+func TestErrorMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Error{
+		Code:   422,
+		Msg:    "invalid",
+		Fields: map[string]interface{}{"field": "name"},
+	})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"code":422,"message":"invalid","field":"name"}`, string(b))
+}
+
+func TestAsError(t *testing.T) {
+	e, ok := asError(pkgerrors.WithStack(Error{Code: 401}))
+	assert.True(t, ok)
+	assert.Equal(t, 401, e.Code)
+
+	_, ok = asError(io.EOF)
+	assert.False(t, ok)
+}
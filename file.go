@@ -0,0 +1,146 @@
+package goa
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/goa-go/goa/responser"
+)
+
+// File responds the file at the path.
+// Range requests (206/416), If-Modified-Since, etc. are supported,
+// Content-Type is detected by the extension or the content,
+// and Last-Modified is set by the modification time.
+// If a status other than 200 is set, e.g. c.Status(404) for a 404 page,
+// the file is responded as a whole with the status.
+// The file is closed after the response, even if it's not responded.
+// It returns goa.Error with 404 if the file doesn't exist or is a directory.
+func (c *Context) File(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileError(err)
+	}
+	return c.serveFile(f, filepath.Base(path))
+}
+
+// FileFS responds the file named name in fsys like c.File, e.g. with an embed.FS.
+func (c *Context) FileFS(fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return fileError(err)
+	}
+	return c.serveFile(f, path.Base(name))
+}
+
+func (c *Context) serveFile(f fs.File, name string) error {
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fileError(err)
+	}
+	if info.IsDir() {
+		f.Close()
+		return fileError(fs.ErrNotExist)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		c.ct = ct
+	}
+	c.SetResponser(responser.Content{
+		Request: c.Request,
+		Name:    name,
+		ModTime: info.ModTime(),
+		Data:    content,
+	})
+	return nil
+}
+
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return Error{
+			Code:  http.StatusNotFound,
+			Msg:   http.StatusText(http.StatusNotFound),
+			Cause: err,
+		}
+	}
+	return err
+}
+
+// Attachment sets Content-Disposition to make the client download the response,
+// with the filename encoded by RFC 5987 if it's not ASCII.
+// Content-Type is set by the extension of filename if it's not set.
+func (c *Context) Attachment(filename string) {
+	if filename != "" {
+		filename = filepath.Base(filename)
+		if c.ct == "" {
+			c.ct = mime.TypeByExtension(filepath.Ext(filename))
+		}
+	}
+	c.SetHeader("Content-Disposition", contentDisposition("attachment", filename))
+}
+
+// Stream responds the data read from r,
+// Content-Type is application/octet-stream unless it's set.
+func (c *Context) Stream(r io.Reader) {
+	if c.ct == "" {
+		c.ct = "application/octet-stream"
+	}
+	c.SetResponser(responser.Reader{Data: r})
+}
+
+// contentDisposition returns the Content-Disposition value,
+// a non-ASCII filename is added as filename* with a ASCII fallback.
+func contentDisposition(kind, filename string) string {
+	if filename == "" {
+		return kind
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	value := kind + `; filename="` + fallback + `"`
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent-encodes s except attr-char of RFC 5987.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b.WriteByte(ch)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[ch>>4])
+			b.WriteByte(hex[ch&15])
+		}
+	}
+	return b.String()
+}
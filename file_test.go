@@ -0,0 +1,197 @@
+package goa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/goa-go/goa/responser"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileServer(t *testing.T, m Middleware) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "goa")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "hello.txt"), []byte("Hello Goa!"), 0644))
+
+	app := New()
+	app.Use(func(c *Context) {
+		c.Set("dir", dir)
+		c.Next()
+	})
+	app.Use(m)
+	return httptest.NewServer(app), dir
+}
+
+func getRange(t *testing.T, url, r string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if r != "" {
+		req.Header.Set("Range", r)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestFile(t *testing.T) {
+	ts, dir := fileServer(t, func(c *Context) {
+		dir, _ := c.Get("dir")
+		if err := c.File(filepath.Join(dir.(string), c.Path)); err != nil {
+			panic(err)
+		}
+	})
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+
+	resp, body := getRange(t, ts.URL+"/hello.txt", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Hello Goa!", body)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.NotEqual(t, "", resp.Header.Get("Last-Modified"))
+
+	resp, body = getRange(t, ts.URL+"/hello.txt", "bytes=6-")
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "bytes 6-9/10", resp.Header.Get("Content-Range"))
+	assert.Equal(t, "Goa!", body)
+
+	resp, body = getRange(t, ts.URL+"/hello.txt", "bytes=0-4,6-8")
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/byteranges"))
+	assert.Contains(t, body, "Hello")
+	assert.Contains(t, body, "Goa")
+
+	resp, _ = getRange(t, ts.URL+"/hello.txt", "bytes=20-")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+
+	resp, _ = getRange(t, ts.URL+"/missing.txt", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = getRange(t, ts.URL+"/", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestFileStatus(t *testing.T) {
+	ts, dir := fileServer(t, func(c *Context) {
+		dir, _ := c.Get("dir")
+		c.Status(http.StatusNotFound)
+		if err := c.File(filepath.Join(dir.(string), "hello.txt")); err != nil {
+			panic(err)
+		}
+	})
+	defer ts.Close()
+	defer os.RemoveAll(dir)
+
+	// the content is responded as a whole with the status, Range is ignored
+	resp, body := getRange(t, ts.URL, "bytes=6-")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "Hello Goa!", body)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, err := http.Head(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Content-Length"))
+}
+
+type closeRecorder struct {
+	*strings.Reader
+	closed int
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed++
+	return nil
+}
+
+func TestFileClosed(t *testing.T) {
+	var bodies []*closeRecorder
+	ts := testServer(func(c *Context) {
+		body := &closeRecorder{Reader: strings.NewReader("body")}
+		bodies = append(bodies, body)
+		c.SetResponser(responser.Content{Request: c.Request, Data: body})
+
+		switch c.Path {
+		case "/error":
+			c.Error(http.StatusBadRequest, "bad request")
+		case "/handled":
+			c.Handled = true
+		case "/replaced":
+			c.String("replaced")
+		case "/nocontent":
+			c.Status(http.StatusNoContent)
+		}
+	})
+	defer ts.Close()
+
+	for _, path := range []string{"/", "/error", "/handled", "/replaced", "/nocontent"} {
+		resp, err := http.Get(ts.URL + path)
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 5, len(bodies))
+	for _, body := range bodies {
+		assert.Equal(t, 1, body.closed)
+	}
+}
+
+func TestFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"static/app.js": &fstest.MapFile{Data: []byte("console.log('goa')"), ModTime: time.Unix(0, 0)},
+	}
+	app := New()
+	app.UseErr(func(c *Context) error {
+		return c.FileFS(fsys, strings.TrimPrefix(c.Path, "/"))
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, body := getRange(t, ts.URL+"/static/app.js", "bytes=0-6")
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "console", body)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "javascript")
+
+	resp, _ = getRange(t, ts.URL+"/static/none.js", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAttachment(t *testing.T) {
+	c := &Context{}
+	c.ResponseWriter = httptest.NewRecorder()
+	c.Attachment("/path/to/report.pdf")
+	assert.Equal(t, `attachment; filename="report.pdf"`, c.ResponseWriter.Header().Get("Content-Disposition"))
+	assert.Equal(t, "application/pdf", c.ContentType())
+
+	c = &Context{}
+	c.ResponseWriter = httptest.NewRecorder()
+	c.Attachment("报告 1.txt")
+	assert.Equal(t, `attachment; filename="__ 1.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A%201.txt`,
+		c.ResponseWriter.Header().Get("Content-Disposition"))
+
+	c = &Context{}
+	c.ResponseWriter = httptest.NewRecorder()
+	c.Attachment("")
+	assert.Equal(t, "attachment", c.ResponseWriter.Header().Get("Content-Disposition"))
+}
+
+func TestStream(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		c.Attachment("data.csv")
+		c.Stream(strings.NewReader("a,b\n1,2\n"))
+	})
+	defer ts.Close()
+
+	resp, body := getRange(t, ts.URL, "")
+	assert.Equal(t, "a,b\n1,2\n", body)
+	assert.Equal(t, `attachment; filename="data.csv"`, resp.Header.Get("Content-Disposition"))
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+}
@@ -0,0 +1,77 @@
+package goa
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Fresh reports whether the response is still fresh for the client,
+// by checking If-None-Match and If-Modified-Since of the request
+// against ETag and Last-Modified of the response.
+// It's only true for GET and HEAD requests with 2xx or 304 status,
+// so the status must be set before like koa, it's 404 by default.
+// For example,
+// c.Status(200)
+// c.SetHeader("ETag", etag)
+// if c.Fresh() {
+//   c.Status(304)
+//   return
+// }
+func (c *Context) Fresh() bool {
+	if c.Method != http.MethodGet && c.Method != http.MethodHead {
+		return false
+	}
+	if (c.status < 200 || c.status >= 300) && c.status != http.StatusNotModified {
+		return false
+	}
+	return fresh(c.Request.Header, c.ResponseWriter.Header())
+}
+
+// Stale is the opposite of c.Fresh().
+func (c *Context) Stale() bool {
+	return !c.Fresh()
+}
+
+func fresh(req, res http.Header) bool {
+	modifiedSince := req.Get("If-Modified-Since")
+	noneMatch := req.Get("If-None-Match")
+	if modifiedSince == "" && noneMatch == "" {
+		return false
+	}
+
+	// end-to-end reload
+	if strings.Contains(req.Get("Cache-Control"), "no-cache") {
+		return false
+	}
+
+	if noneMatch != "" && noneMatch != "*" {
+		etag := res.Get("ETag")
+		if etag == "" || !matchETag(noneMatch, etag) {
+			return false
+		}
+	}
+
+	if modifiedSince != "" {
+		since, err := http.ParseTime(modifiedSince)
+		if err != nil {
+			return false
+		}
+		lastModified, err := http.ParseTime(res.Get("Last-Modified"))
+		if err != nil || lastModified.After(since) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchETag reports whether etag matches one of the tags of If-None-Match, weakly.
+func matchETag(noneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(noneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package goa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freshContext(method string, req, res map[string]string) *Context {
+	c := &Context{Method: method, status: http.StatusOK}
+	c.Request, _ = http.NewRequest(method, "/", nil)
+	for k, v := range req {
+		c.Request.Header.Set(k, v)
+	}
+	c.ResponseWriter = httptest.NewRecorder()
+	for k, v := range res {
+		c.ResponseWriter.Header().Set(k, v)
+	}
+	return c
+}
+
+func TestFreshETag(t *testing.T) {
+	c := freshContext("GET", map[string]string{"If-None-Match": `"foo"`}, map[string]string{"ETag": `"foo"`})
+	assert.True(t, c.Fresh())
+	assert.False(t, c.Stale())
+
+	c = freshContext("GET", map[string]string{"If-None-Match": `"bar", W/"foo"`}, map[string]string{"ETag": `"foo"`})
+	assert.True(t, c.Fresh())
+
+	c = freshContext("GET", map[string]string{"If-None-Match": `"bar"`}, map[string]string{"ETag": `"foo"`})
+	assert.False(t, c.Fresh())
+
+	c = freshContext("GET", map[string]string{"If-None-Match": `"foo"`}, nil)
+	assert.False(t, c.Fresh())
+
+	c = freshContext("POST", map[string]string{"If-None-Match": `"foo"`}, map[string]string{"ETag": `"foo"`})
+	assert.False(t, c.Fresh())
+
+	c = freshContext("GET", map[string]string{"If-None-Match": `"foo"`, "Cache-Control": "no-cache"}, map[string]string{"ETag": `"foo"`})
+	assert.False(t, c.Fresh())
+
+	c = freshContext("GET", map[string]string{"If-None-Match": `"foo"`}, map[string]string{"ETag": `"foo"`})
+	c.status = http.StatusNotFound
+	assert.False(t, c.Fresh())
+}
+
+func TestFreshLastModified(t *testing.T) {
+	c := freshContext("GET",
+		map[string]string{"If-Modified-Since": "Sat, 01 Jan 2000 00:00:00 GMT"},
+		map[string]string{"Last-Modified": "Sat, 01 Jan 2000 00:00:00 GMT"})
+	assert.True(t, c.Fresh())
+
+	c = freshContext("HEAD",
+		map[string]string{"If-Modified-Since": "Sat, 01 Jan 2000 00:00:00 GMT"},
+		map[string]string{"Last-Modified": "Sun, 02 Jan 2000 00:00:00 GMT"})
+	assert.False(t, c.Fresh())
+
+	c = freshContext("GET",
+		map[string]string{"If-Modified-Since": "Sat, 01 Jan 2000 00:00:00 GMT"},
+		nil)
+	assert.False(t, c.Fresh())
+
+	c = freshContext("GET", nil, map[string]string{"Last-Modified": "Sat, 01 Jan 2000 00:00:00 GMT"})
+	assert.False(t, c.Fresh())
+}
+
+func TestFreshUsage(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		c.Status(http.StatusOK)
+		c.SetHeader("ETag", `"goa"`)
+		if c.Fresh() {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.String("Hello Goa!")
+	})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("If-None-Match", `"goa"`)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
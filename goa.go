@@ -1,11 +1,18 @@
 package goa
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/goa-go/goa/responser"
+	"github.com/goa-go/goa/websocket"
 	"github.com/pkg/errors"
 )
 
@@ -17,15 +24,77 @@ type Middleware func(*Context)
 // Middlewares is []Middleware.
 type Middlewares []Middleware
 
+// ErrMiddleware is a middleware which returns an error instead of panicking,
+// the error propagates up through c.Next() and is handled by goa at last.
+// should be used liked app.UseErr(middleware).
+type ErrMiddleware func(*Context) error
+
+// chain is a middleware chain, where a Middleware is called directly by c.Next()
+// instead of being converted to an ErrMiddleware, which would cost a call frame per middleware.
+type chain struct {
+	errMiddlewares []ErrMiddleware // errMiddlewares[i] is called if it's not nil
+	middlewares    []Middleware    // or else middlewares[i]
+}
+
+// use appends a middleware, one of m and e is nil.
+func (ch *chain) use(m Middleware, e ErrMiddleware) {
+	ch.errMiddlewares = append(ch.errMiddlewares, e)
+	ch.middlewares = append(ch.middlewares, m)
+}
+
+func (ch chain) len() int {
+	return len(ch.errMiddlewares)
+}
+
+// ErrorHandler handles the errors thrown in middlewares.
+type ErrorHandler func(*Context, error)
+
 // Goa is the framework's instance.
 type Goa struct {
-	middlewares Middlewares
+	// ErrorLog specifies an optional logger for errors,
+	// if nil, logging is done via the log package's standard logger.
+	ErrorLog *log.Logger
+
+	// ShutdownTimeout is the maximum duration to wait for in-flight requests
+	// when shutting down on a signal, and for the OnShutdown hooks after a drain timeout,
+	// zero means waiting forever.
+	ShutdownTimeout time.Duration
+
+	// RequestTimeout is the default timeout of the request context,
+	// when it's exceeded and the response is not handled, goa answers 503.
+	// Middlewares should respect it by c.Done() or passing c to blocking calls.
+	RequestTimeout time.Duration
+
+	// Debug enables the checks for misuse, it should not be used in production.
+	// Contexts are not reused, a Context used after the request is handled panics.
+	Debug bool
+
+	// Upgrader is the options of the WebSocket handshake of c.Upgrade().
+	Upgrader websocket.Upgrader
+
+	middlewares chain
 	pool        sync.Pool
+
+	server       *http.Server
+	serverOnce   sync.Once
+	shutdownOnce sync.Once
+	shutdownErr  error
+	shutdown     chan struct{} // closed when app.Shutdown starts
+	done         chan struct{} // closed when app.Shutdown finishes
+	hijacked     requestGroup  // the in-flight h2c requests
+	onStart      []func() error
+	onShutdown   []func(context.Context) error
+
+	errorHandler ErrorHandler
+	errorHooks   []ErrorHandler
 }
 
 // New returns the initialized Goa instance.
 func New() *Goa {
-	app := &Goa{}
+	app := &Goa{
+		ShutdownTimeout: 10 * time.Second,
+		errorHandler:    DefaultErrorHandler,
+	}
 	app.pool.New = func() interface{} {
 		return &Context{app: app}
 	}
@@ -34,83 +103,348 @@ func New() *Goa {
 
 // ServeHTTP makes the app implement the http.Handler interface.
 func (app *Goa) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if len(app.middlewares) > 0 {
+	if app.middlewares.len() > 0 {
 		c := app.pool.Get().(*Context)
 		// c.middlewares = app.middlewares
 		c.init(w, r)
 
 		app.handleRequest(c)
 
-		app.pool.Put(c)
+		app.release(c)
 	}
 }
 
+func (app *Goa) release(c *Context) {
+	if app.Debug {
+		c.release()
+		return
+	}
+	app.pool.Put(c)
+}
+
 // Use a middleware.
 func (app *Goa) Use(m Middleware) {
-	app.middlewares = append(app.middlewares, m)
+	app.middlewares.use(m, nil)
+}
+
+// UseErr uses a middleware which returns an error.
+// For example,
+// app.UseErr(func(c *goa.Context) error {
+//   if err := c.Next(); err != nil {
+//     return err
+//   }
+//   return nil
+// })
+func (app *Goa) UseErr(m ErrMiddleware) {
+	app.middlewares.use(nil, m)
+}
+
+// Mount mounts the child app under the path prefix, like koa-mount.
+// While the middlewares of child run, c.Path is stripped of the prefix,
+// it's restored afterwards.
+// When the last middleware of child calls c.Next(), the downstream of app continues.
+func (app *Goa) Mount(prefix string, child *Goa) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	app.UseErr(func(c *Context) error {
+		path, ok := stripPrefix(c.Path, prefix)
+		if !ok || child.middlewares.len() == 0 {
+			return c.Next()
+		}
+		return c.run(child.middlewares, path)
+	})
+}
+
+// stripPrefix returns the path without prefix and whether path matches the prefix.
+// "/admin" matches "/admin" and "/admin/users", but not "/administrator".
+func stripPrefix(path, prefix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	path = path[len(prefix):]
+	if path == "" {
+		return "/", true
+	}
+	if path[0] != '/' {
+		return "", false
+	}
+	return path, true
+}
+
+// OnError sets the handler which responds errors,
+// e.g. rendering them as JSON or HTML depending on the route.
+// DefaultErrorHandler is used by default.
+func (app *Goa) OnError(handler ErrorHandler) {
+	app.errorHandler = handler
+}
+
+// AddErrorHook adds a hook which is called with every error before it's handled,
+// e.g. to report it to an error tracker.
+// Errors recovered from panics carry the stack trace, it can be printed by "%+v".
+// Errors are logged to app.ErrorLog only when no hook is added.
+func (app *Goa) AddErrorHook(hook ErrorHandler) {
+	app.errorHooks = append(app.errorHooks, hook)
 }
 
-// Listen starts server with the addr.
-func (app *Goa) Listen(addr string) error {
-	return http.ListenAndServe(addr, app)
+func (app *Goa) logf(format string, args ...interface{}) {
+	if app.ErrorLog != nil {
+		app.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
 }
 
 func (app *Goa) handleRequest(c *Context) {
+	defer app.finishRequest(c)
+	// only the app-level timeout turns into 503, not the ones set by middlewares
+	var timeout context.Context
+	if app.RequestTimeout > 0 {
+		defer c.WithTimeout(app.RequestTimeout)()
+		timeout = c.Request.Context()
+	}
 	defer func() {
-		if err := recover(); err != nil {
-			app.onerror(c, err)
+		if v := recover(); v != nil {
+			app.handleError(c, recovered(v))
 		}
 	}()
 
-	app.middlewares[0](c)
+	err := c.Next()
+	if timeout != nil && timeout.Err() == context.DeadlineExceeded &&
+		!c.redirected && !c.Handled && !c.written() {
+		err = Error{
+			Code:  http.StatusServiceUnavailable,
+			Msg:   http.StatusText(http.StatusServiceUnavailable),
+			Cause: context.DeadlineExceeded,
+		}
+	}
+	if err != nil {
+		app.handleError(c, err)
+		return
+	}
 
-	if !c.redirected && !c.Handled {
+	if !c.redirected && !c.Handled && !c.written() {
 		app.handleResponse(c)
 	}
 }
 
+// finishRequest closes what's left by the request and sends the buffered response.
+func (app *Goa) finishRequest(c *Context) {
+	// the body left unresponded is closed, e.g. if the handler fails after c.File
+	if !c.responded && c.responser != nil {
+		if closer := bodyCloser(c.responser); closer != nil {
+			closer.Close()
+		}
+	}
+	if c.stream != nil {
+		c.stream.Close()
+	}
+	for i := len(c.finishers) - 1; i >= 0; i-- {
+		if err := c.finishers[i](); err != nil {
+			app.logf("[ERROR] %+v", errors.WithStack(err))
+		}
+	}
+	// the response has been sent unless it's buffered
+	if c.writer.buffering {
+		if err := c.writer.finish(); err != nil {
+			app.logf("[ERROR] %+v", errors.WithStack(err))
+		}
+	}
+}
+
 func (app *Goa) handleResponse(c *Context) {
+	// Content writes the status by itself for Range and conditional requests,
+	// unless another status is set, e.g. for a 404 page, then it's responded as a whole
+	if content, ok := c.responser.(responser.Content); ok {
+		if !c.explicitStatus || c.status == http.StatusOK {
+			if c.ct != "" {
+				c.writeContentType(c.ct)
+			}
+			c.responded = true
+			c.respond(c.responser)
+			return
+		}
+		if size, err := content.Data.Seek(0, io.SeekEnd); err == nil {
+			if _, err := content.Data.Seek(0, io.SeekStart); err == nil {
+				c.ResponseWriter.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+			}
+		}
+		c.responser = responser.Reader{Data: content.Data}
+	}
+
+	// 1xx, 204 and 304 responses have no body
+	if bodiless(c.status) {
+		header := c.ResponseWriter.Header()
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		c.ResponseWriter.WriteHeader(c.status)
+		return
+	}
+
+	// Response
+	if c.responser == nil {
+		c.ct = "text/plain; charset=utf-8"
+		c.responser = responser.String{Data: http.StatusText(c.status)}
+	}
 
 	// Content-Type
 	if c.ct != "" {
 		c.writeContentType(c.ct)
 	}
 
+	// HEAD responds the headers of GET only, the body is encoded once to count its length
+	if c.Method == http.MethodHead {
+		header := c.ResponseWriter.Header()
+		if n, ok := contentLength(c.responser); ok && header.Get("Content-Length") == "" {
+			header.Set("Content-Length", strconv.FormatInt(n, 10))
+		}
+		c.ResponseWriter.WriteHeader(c.status)
+		return
+	}
+
 	// Status code
 	c.ResponseWriter.WriteHeader(c.status)
 
-	// Response
-	if c.responser == nil {
-		c.String(http.StatusText(c.status))
-	}
-
+	c.responded = true
 	if err := c.respond(c.responser); err != nil {
-		log.Printf("[ERROR] %+v", errors.WithStack(err))
+		app.logf("[ERROR] %+v", errors.WithStack(err))
+		// a stream or a partially written body can't be taken back, the response is cut off
+		if streaming(c.responser) || c.Response().Size() > 0 {
+			return
+		}
 		c.respond(responser.String{Data: http.StatusText(http.StatusInternalServerError)})
 	}
 }
 
-func (app *Goa) onerror(c *Context, err interface{}) {
+// streaming reports whether the responser writes the body as a stream.
+func streaming(r responser.Responser) bool {
+	switch r.(type) {
+	case responser.Reader, responser.Content, responser.NDJSON, responser.JSONArray:
+		return true
+	}
+	return false
+}
+
+// bodiless reports whether a response with the status must not have a body.
+func bodiless(status int) bool {
+	return (status >= 100 && status < 200) ||
+		status == http.StatusNoContent ||
+		status == http.StatusResetContent ||
+		status == http.StatusNotModified
+}
+
+// contentLength returns the length of the body responded by r,
+// the length of a stream is known only if it has a Len method, e.g. *bytes.Reader,
+// and JSON streams are never consumed.
+func contentLength(r responser.Responser) (int64, bool) {
+	switch r := r.(type) {
+	case responser.Reader:
+		if l, ok := r.Data.(interface{ Len() int }); ok {
+			return int64(l.Len()), true
+		}
+		return 0, false
+	case responser.NDJSON, responser.JSONArray:
+		return 0, false
+	}
+
+	w := &countWriter{header: make(http.Header)}
+	if err := r.Respond(w); err != nil {
+		return 0, false
+	}
+	return w.n, true
+}
+
+// countWriter counts the bytes written and discards them.
+type countWriter struct {
+	header http.Header
+	n      int64
+}
+
+func (w *countWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+func (w *countWriter) WriteHeader(int) {}
+
+func (app *Goa) handleError(c *Context, err error) {
+	e, ok := asError(err)
+	logged := len(app.errorHooks) == 0 && (!ok || !e.Exposed())
+	if logged {
+		app.logf("[ERROR] %+v", err)
+	}
+	for _, hook := range app.errorHooks {
+		hook(c, err)
+	}
+
+	// the response has been sent, the error can only be logged
+	if !c.Response().Reset() {
+		if !logged {
+			app.logf("[ERROR] %+v", err)
+		}
+		return
+	}
+	if ok {
+		header := c.ResponseWriter.Header()
+		for k, v := range e.Header {
+			header[k] = v
+		}
+	}
+
+	app.errorHandler(c, err)
+}
+
+// panicValue is a recovered value which is neither an error nor a string.
+type panicValue struct {
+	value interface{}
+}
+
+func (v panicValue) Error() string {
+	return fmt.Sprint(v.value)
+}
+
+// recovered converts the value recovered from a panic to an error with the stack trace.
+func recovered(v interface{}) error {
+	switch e := v.(type) {
+	case Error:
+		return e
+	case error:
+		return errors.WithStack(e)
+	case string:
+		return errors.New(e)
+	default:
+		return errors.WithStack(panicValue{v})
+	}
+}
+
+// DefaultErrorHandler responds the error as text/plain,
+// with the code and exposed message of goa.Error, or 500 and its status text otherwise,
+// so the messages of other errors are never leaked to the client.
+// goa.Error with Fields is responded as application/json.
+func DefaultErrorHandler(c *Context, err error) {
 	code := http.StatusInternalServerError
 	msg := http.StatusText(http.StatusInternalServerError)
 
-	if e, ok := err.(Error); ok {
+	e, ok := asError(err)
+	if ok {
 		code = e.Code
-		msg = e.Msg
-	} else if e, ok := err.(error); ok {
-		log.Printf("[ERROR] %+v", errors.WithStack(e))
-		msg = e.Error()
-	} else if str, ok := err.(string); ok {
-		log.Print("[ERROR] ", str)
-		msg = str
-	} else {
-		log.Print("[ERROR] ", err)
+		msg = e.Message()
 	}
 
-	c.ct = "text/plain; charset=utf-8"
-	c.writeContentType(c.ct)
 	c.SetHeader("X-Content-Type-Options", "nosniff")
+	if len(e.Fields) > 0 {
+		c.ct = "application/json; charset=utf-8"
+		c.writeContentType(c.ct)
+		c.ResponseWriter.WriteHeader(code)
+		c.respond(responser.JSON{Data: e})
+		return
+	}
 
+	c.ct = "text/plain; charset=utf-8"
+	c.writeContentType(c.ct)
 	c.ResponseWriter.WriteHeader(code)
 	c.respond(responser.String{Data: msg})
 }
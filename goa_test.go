@@ -1,12 +1,18 @@
 package goa
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/goa-go/goa/responser"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -90,6 +96,45 @@ func TestGoaError(t *testing.T) {
 	assert.Equal(t, http.StatusText(404), string(body))
 }
 
+func TestGoaErrorNotExposed(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		c.Error(503, "db down")
+	})
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, http.StatusText(503), string(body))
+}
+
+func TestGoaErrorWithHeaderAndFields(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		panic(Error{
+			Code:   429,
+			Msg:    "slow down",
+			Header: http.Header{"Retry-After": []string{"60"}},
+			Fields: map[string]interface{}{"limit": 10},
+		})
+	})
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"code":429,"message":"slow down","limit":10}`, string(body))
+}
+
 func TestError(t *testing.T) {
 	ts := testServer(func(c *Context) {
 		panic(errors.New("error"))
@@ -103,7 +148,7 @@ func TestError(t *testing.T) {
 
 	assert.Nil(t, err)
 	assert.Equal(t, 500, resp.StatusCode)
-	assert.Equal(t, "error", string(body))
+	assert.Equal(t, http.StatusText(500), string(body))
 }
 
 func TestStringError(t *testing.T) {
@@ -119,7 +164,7 @@ func TestStringError(t *testing.T) {
 
 	assert.Nil(t, err)
 	assert.Equal(t, 500, resp.StatusCode)
-	assert.Equal(t, "error", string(body))
+	assert.Equal(t, http.StatusText(500), string(body))
 }
 
 func TestIntError(t *testing.T) {
@@ -138,6 +183,100 @@ func TestIntError(t *testing.T) {
 	assert.Equal(t, http.StatusText(500), string(body))
 }
 
+func TestOnError(t *testing.T) {
+	app := New()
+	app.OnError(func(c *Context, err error) {
+		c.SetHeader("Content-Type", "application/json")
+		c.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+		c.respond(responser.JSON{Data: M{"error": err.Error()}})
+	})
+	app.Use(func(c *Context) {
+		panic(errors.New("error"))
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "{\"error\":\"error\"}\n", string(body))
+}
+
+func panicInMiddleware(c *Context) {
+	panic(errors.New("error"))
+}
+
+func TestErrorHook(t *testing.T) {
+	var reported string
+	buf := new(bytes.Buffer)
+	app := New()
+	app.ErrorLog = log.New(buf, "", 0)
+	app.AddErrorHook(func(c *Context, err error) {
+		reported = fmt.Sprintf("%+v", err)
+	})
+	app.Use(panicInMiddleware)
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, 500, resp.StatusCode)
+	assert.Contains(t, reported, "panicInMiddleware")
+	assert.Equal(t, "", buf.String())
+}
+
+func TestErrorLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	app := New()
+	app.ErrorLog = log.New(buf, "", 0)
+	app.Use(func(c *Context) {
+		panic("error")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Contains(t, buf.String(), "[ERROR] error")
+}
+
+func TestErrorAfterSent(t *testing.T) {
+	buf := new(bytes.Buffer)
+	var hooked error
+	app := New()
+	app.ErrorLog = log.New(buf, "", 0)
+	app.AddErrorHook(func(c *Context, err error) {
+		hooked = err
+	})
+	app.UseErr(func(c *Context) error {
+		c.ResponseWriter.Write([]byte("partial"))
+		return errors.New("failed")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "partial", string(body))
+	assert.EqualError(t, hooked, "failed")
+	assert.Contains(t, buf.String(), "[ERROR] failed")
+	assert.NotContains(t, buf.String(), "[WARN]")
+}
+
 func TestRespondError(t *testing.T) {
 	ts := testServer(func(c *Context) {
 		c.XML([]byte{1, 2, 3})
@@ -162,3 +301,283 @@ func TestListen(t *testing.T) {
 	}()
 	assert.Nil(t, err)
 }
+
+func TestMount(t *testing.T) {
+	paths := []string{}
+	admin := New()
+	admin.Use(func(c *Context) {
+		paths = append(paths, "admin "+c.Path)
+		if c.Path == "/users" {
+			c.String("users")
+			return
+		}
+		c.Next()
+		paths = append(paths, "admin "+c.Path)
+	})
+
+	app := New()
+	app.Mount("/admin/", admin)
+	app.Use(func(c *Context) {
+		paths = append(paths, "app "+c.Path)
+		c.String("app")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	get := func(path string) string {
+		resp, err := http.Get(ts.URL + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, "users", get("/admin/users"))
+	assert.Equal(t, []string{"admin /users"}, paths)
+
+	paths = paths[:0]
+	assert.Equal(t, "app", get("/admin"))
+	assert.Equal(t, []string{"admin /", "app /admin", "admin /"}, paths)
+
+	paths = paths[:0]
+	assert.Equal(t, "app", get("/administrator"))
+	assert.Equal(t, []string{"app /administrator"}, paths)
+}
+
+func TestNestedMount(t *testing.T) {
+	users := New()
+	users.Use(func(c *Context) {
+		c.String(c.Path)
+	})
+	api := New()
+	api.Mount("/users", users)
+	app := New()
+	app.Mount("/api", api)
+	app.Use(func(c *Context) {
+		c.Error(404, "not found")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/users/1")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "/1", string(body))
+
+	resp, err = http.Get(ts.URL + "/api/posts")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 404, resp.StatusCode)
+}
+
+func TestMountNextTwice(t *testing.T) {
+	calls := 0
+	admin := New()
+	admin.Use(func(c *Context) {
+		c.Next()
+		assert.Nil(t, c.Next())
+	})
+	app := New()
+	app.Mount("/admin", admin)
+	app.Use(func(c *Context) {
+		calls++
+		c.String("app")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/admin")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, "app", string(body))
+	assert.Equal(t, 1, calls)
+}
+
+func TestStripPrefix(t *testing.T) {
+	path, ok := stripPrefix("/admin/users", "/admin")
+	assert.True(t, ok)
+	assert.Equal(t, "/users", path)
+
+	path, ok = stripPrefix("/admin", "/admin")
+	assert.True(t, ok)
+	assert.Equal(t, "/", path)
+
+	_, ok = stripPrefix("/administrator", "/admin")
+	assert.False(t, ok)
+
+	path, ok = stripPrefix("/users", "")
+	assert.True(t, ok)
+	assert.Equal(t, "/users", path)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	app := New()
+	app.RequestTimeout = 10 * time.Millisecond
+	app.Use(func(c *Context) {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+		}
+		c.String("too late")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusServiceUnavailable), string(body))
+}
+
+func TestRequestTimeoutWritten(t *testing.T) {
+	app := New()
+	app.RequestTimeout = 10 * time.Millisecond
+	app.Use(func(c *Context) {
+		c.ResponseWriter.Write([]byte("done"))
+		<-c.Done()
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "done", string(body))
+}
+
+func TestMiddlewareTimeout(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.Next()
+		assert.Nil(t, c.Err())
+	})
+	app.Use(func(c *Context) {
+		func() {
+			defer c.WithTimeout(time.Millisecond)()
+			<-c.Done()
+		}()
+		c.String("ok")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestRequestInTime(t *testing.T) {
+	app := New()
+	app.RequestTimeout = time.Second
+	app.Use(func(c *Context) {
+		_, ok := c.Deadline()
+		assert.True(t, ok)
+		c.String("in time")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "in time", string(body))
+}
+
+func TestBodilessStatus(t *testing.T) {
+	for _, code := range []int{http.StatusNoContent, http.StatusNotModified} {
+		ts := testServer(func(c *Context) {
+			c.Status(code)
+			c.JSON(M{"key": "value"})
+		})
+		resp, err := http.Get(ts.URL)
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+
+		assert.Equal(t, code, resp.StatusCode)
+		assert.Equal(t, "", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "", string(body))
+	}
+}
+
+func TestHead(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		switch c.Path {
+		case "/json":
+			c.JSON(M{"key": "value"})
+		case "/reader":
+			c.SetBody(strings.NewReader("reader"))
+		case "/ndjson":
+			c.SetResponser(responser.NDJSON{Data: func() (interface{}, bool) {
+				t.Error("the stream is consumed")
+				return nil, false
+			}})
+		}
+	})
+	defer ts.Close()
+
+	resp, err := http.Head(ts.URL + "/json")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len("{\"key\":\"value\"}\n")), resp.ContentLength)
+
+	resp, err = http.Head(ts.URL + "/reader")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int64(len("reader")), resp.ContentLength)
+
+	resp, err = http.Head(ts.URL + "/ndjson")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Head(ts.URL + "/none")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(http.StatusText(http.StatusNotFound))), resp.ContentLength)
+}
+
+func TestRespondStreamFailed(t *testing.T) {
+	app := New()
+	app.ErrorLog = log.New(ioutil.Discard, "", 0)
+	app.Use(func(c *Context) {
+		sent := false
+		c.SetResponser(responser.NDJSON{Data: func() (interface{}, error) {
+			if sent {
+				return nil, errors.New("failed")
+			}
+			sent = true
+			return 1, nil
+		}})
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1\n", string(body))
+}
@@ -0,0 +1,55 @@
+package goa
+
+import (
+	"fmt"
+)
+
+// Key is a typed key of the request-scoped state.
+// Unlike the string keys of c.Keys, two keys never collide even with the same name,
+// and the values need no type assertion.
+// For example,
+// var userKey = goa.NewKey[*User]("user")
+// userKey.Set(c, user)
+// user := userKey.MustGet(c)
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new typed key, the name is only used in messages.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key.
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Set stores the value in c.
+func (k *Key[T]) Set(c *Context, value T) {
+	c.checkReleased()
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[k] = value
+}
+
+// Get returns the value stored in c and whether it exists.
+func (k *Key[T]) Get(c *Context) (value T, exists bool) {
+	c.checkReleased()
+	v, exists := c.values[k]
+	if exists {
+		// a nil value of an interface type fails the assertion, it's the zero value
+		value, _ = v.(T)
+	}
+	return
+}
+
+// MustGet returns the value stored in c, it panics if the value doesn't exist.
+func (k *Key[T]) MustGet(c *Context) T {
+	value, exists := k.Get(c)
+	if !exists {
+		panic(fmt.Errorf("goa: key %q does not exist", k.name))
+	}
+	return value
+}
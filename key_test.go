@@ -0,0 +1,63 @@
+package goa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string
+}
+
+func TestKey(t *testing.T) {
+	c := &Context{}
+	userKey := NewKey[*user]("user")
+	nameKey := NewKey[string]("user")
+
+	_, exists := userKey.Get(c)
+	assert.False(t, exists)
+
+	userKey.Set(c, &user{Name: "goa"})
+	nameKey.Set(c, "name")
+	c.Set("user", 1)
+
+	u, exists := userKey.Get(c)
+	assert.True(t, exists)
+	assert.Equal(t, "goa", u.Name)
+	assert.Equal(t, "goa", userKey.MustGet(c).Name)
+	assert.Equal(t, "name", nameKey.MustGet(c))
+	value, _ := c.Get("user")
+	assert.Equal(t, 1, value)
+	assert.Equal(t, "user", userKey.String())
+}
+
+func TestKeyNilInterface(t *testing.T) {
+	c := &Context{}
+	errKey := NewKey[error]("err")
+	errKey.Set(c, nil)
+
+	err, exists := errKey.Get(c)
+	assert.True(t, exists)
+	assert.Nil(t, err)
+	assert.Nil(t, errKey.MustGet(c))
+}
+
+func TestKeyMustGetFailed(t *testing.T) {
+	c := &Context{}
+	defer func() {
+		err := recover()
+		assert.EqualError(t, err.(error), `goa: key "user" does not exist`)
+	}()
+
+	NewKey[string]("user").MustGet(c)
+}
+
+func TestKeyValue(t *testing.T) {
+	c := &Context{}
+	key := NewKey[int]("count")
+	key.Set(c, 1)
+
+	assert.Equal(t, 1, c.Value(key))
+	assert.Equal(t, 1, c.Copy().Value(key))
+}
@@ -0,0 +1,329 @@
+// Package compress implements a goa middleware which compresses responses
+// with br, zstd, gzip or deflate, negotiated by Accept-Encoding.
+package compress // import "github.com/goa-go/goa/middleware/compress"
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/goa-go/goa"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMinLength is the default minimum length of the bodies which are compressed.
+const DefaultMinLength = 1024
+
+// Options is the options of the compress middleware.
+type Options struct {
+	// Encodings are the encodings supported in order of preference,
+	// "br", "zstd", "gzip" and "deflate" by default.
+	Encodings []string
+
+	// MinLength is the minimum length of the bodies which are compressed, DefaultMinLength by default.
+	// A body whose length is unknown is buffered until it reaches MinLength or it's flushed.
+	// A negative value compresses every body.
+	MinLength int
+
+	// Compressible reports whether the body of the Content-Type is compressed,
+	// Compressible is used by default.
+	Compressible func(contentType string) bool
+}
+
+// encoder is implemented by the writers of all the encodings.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var pools = map[string]*sync.Pool{
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"zstd": {New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// New returns the compress middleware.
+// The ResponseWriter is wrapped before the downstream, so bodies written by responsers,
+// SSE and c.ResponseWriter are all compressed, and every flush is passed through the encoder.
+// Bodiless and partial responses, and responses which have set Content-Encoding are never compressed.
+// Vary: Accept-Encoding is added to every compressible response, whether it's compressed or not,
+// and HEAD gets the headers of GET without a body.
+// For example,
+// app.Use(compress.New(compress.Options{}))
+func New(opts Options) goa.Middleware {
+	if opts.Encodings == nil {
+		opts.Encodings = []string{"br", "zstd", "gzip", "deflate"}
+	}
+	for _, e := range opts.Encodings {
+		if pools[e] == nil {
+			panic("compress: unsupported encoding " + e)
+		}
+	}
+	if opts.MinLength == 0 {
+		opts.MinLength = DefaultMinLength
+	}
+	if opts.Compressible == nil {
+		opts.Compressible = Compressible
+	}
+
+	return func(c *goa.Context) {
+		w := &writer{
+			ResponseWriter: c.ResponseWriter,
+			opts:           &opts,
+			// "" if none is accepted, the response still varies by Accept-Encoding
+			encoding: c.AcceptsEncodings(opts.Encodings...),
+			head:     c.Method == http.MethodHead,
+		}
+		c.ResponseWriter = w
+		c.OnFinish(w.Close)
+		c.Next()
+	}
+}
+
+// Compressible reports whether the content type is not compressed already,
+// images except SVG, audios, videos, fonts of WOFF and archives are compressed already.
+func Compressible(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType == ""
+	}
+
+	switch {
+	case t == "image/svg+xml":
+		return true
+	case strings.HasPrefix(t, "image/"), strings.HasPrefix(t, "audio/"), strings.HasPrefix(t, "video/"):
+		return false
+	}
+	switch t {
+	case "font/woff", "font/woff2",
+		"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+		"application/x-brotli", "application/x-bzip2", "application/x-xz",
+		"application/x-7z-compressed", "application/x-rar-compressed":
+		return false
+	}
+	return true
+}
+
+// writer compresses the body written, the decision is made when the headers are written,
+// or when MinLength bytes are buffered if Content-Length is unknown.
+// It implements goa.ResponseWriter, so goa and the upstream middlewares see the state of it.
+type writer struct {
+	http.ResponseWriter
+
+	opts     *Options
+	encoding string
+	head     bool
+
+	status  int
+	size    int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *writer) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+
+	h := w.Header()
+	switch {
+	case code < http.StatusOK, code == http.StatusNoContent, code == http.StatusNotModified,
+		code == http.StatusPartialContent, h.Get("Content-Encoding") != "":
+		w.decide(false)
+	case !w.opts.Compressible(h.Get("Content-Type")):
+		w.decide(false)
+	default:
+		addVary(h)
+		if w.encoding == "" {
+			w.decide(false)
+		} else if cl := h.Get("Content-Length"); cl != "" {
+			n, err := strconv.Atoi(cl)
+			w.decide(err != nil || n >= w.opts.MinLength)
+		} else if w.opts.MinLength < 0 {
+			w.decide(true)
+		}
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.size += len(b)
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.opts.MinLength {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide writes the headers and the buffered body, compressed or not.
+func (w *writer) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+
+	if compress {
+		if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", w.encoding)
+		// the compressed body is not byte-for-byte identical
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		// HEAD has no body to encode
+		if !w.head {
+			w.enc = pools[w.encoding].Get().(encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush compresses the body buffered, and flushes the encoder and the ResponseWriter,
+// so every event of SSE is sent at once.
+func (w *writer) Flush() {
+	if w.status != 0 && !w.decided {
+		w.decide(true)
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the body buffered and finishes the encoder, it's called after the response is written.
+func (w *writer) Close() error {
+	if w.status != 0 && !w.decided {
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+	err := w.enc.Close()
+	w.enc.Reset(nil)
+	pools[w.encoding].Put(w.enc)
+	w.enc = nil
+	return err
+}
+
+func (w *writer) Status() int {
+	return w.status
+}
+
+// Size returns the number of bytes written before compression.
+func (w *writer) Size() int {
+	return w.size
+}
+
+func (w *writer) Written() bool {
+	return w.status != 0
+}
+
+func (w *writer) Committed() bool {
+	if rw, ok := w.ResponseWriter.(goa.ResponseWriter); ok {
+		return rw.Committed()
+	}
+	return w.decided
+}
+
+func (w *writer) Buffer() {
+	if rw, ok := w.ResponseWriter.(goa.ResponseWriter); ok {
+		rw.Buffer()
+	}
+}
+
+// Reset discards the status and body written before the decision, e.g. for error responses.
+func (w *writer) Reset() bool {
+	if w.decided {
+		return false
+	}
+	if rw, ok := w.ResponseWriter.(goa.ResponseWriter); ok && !rw.Reset() {
+		return false
+	}
+	w.status = 0
+	w.size = 0
+	w.buf = w.buf[:0]
+	return true
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack passes through to the ResponseWriter, e.g. for WebSocket.
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+func (w *writer) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// addVary adds Accept-Encoding to Vary unless it's there.
+func addVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
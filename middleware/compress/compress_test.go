@@ -0,0 +1,280 @@
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/goa-go/goa"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+var text = strings.Repeat("Hello Goa! ", 200)
+
+func testServer(opts Options, m goa.Middleware) *httptest.Server {
+	app := goa.New()
+	app.Use(New(opts))
+	app.Use(m)
+	return httptest.NewServer(app)
+}
+
+func request(t *testing.T, method, url string, header map[string]string) *http.Response {
+	req, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	var r io.Reader = resp.Body
+	var err error
+	switch resp.Header.Get("Content-Encoding") {
+	case "br":
+		r = brotli.NewReader(r)
+	case "zstd":
+		r, err = zstd.NewReader(r)
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	return string(body)
+}
+
+func TestCompress(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		c.String(text)
+	})
+	defer ts.Close()
+
+	for _, encoding := range []string{"br", "zstd", "gzip", "deflate"} {
+		resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": encoding})
+		assert.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, text, decode(t, resp))
+	}
+
+	// the client prefers gzip
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "br;q=0.5, gzip"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, text, decode(t, resp))
+
+	for _, ae := range []string{"", "identity", "compress", "gzip;q=0"} {
+		resp = request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": ae})
+		assert.Equal(t, "", resp.Header.Get("Content-Encoding"), ae)
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"), ae)
+		assert.Equal(t, text, decode(t, resp))
+	}
+
+	// HEAD gets the headers of GET
+	resp = request(t, "HEAD", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "", string(body))
+}
+
+func TestEncodings(t *testing.T) {
+	ts := testServer(Options{Encodings: []string{"gzip"}}, func(c *goa.Context) {
+		c.String(text)
+	})
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "br"})
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, text, decode(t, resp))
+
+	assert.Panics(t, func() {
+		New(Options{Encodings: []string{"lzma"}})
+	})
+}
+
+func TestSkip(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		switch c.Path {
+		case "/small":
+			c.String("small")
+		case "/png":
+			c.SetContentType("image/png")
+			c.SetBody([]byte(text))
+		case "/encoded":
+			c.SetHeader("Content-Encoding", "gzip")
+			c.SetBody([]byte(text))
+		case "/nocontent":
+			c.Status(http.StatusNoContent)
+		case "/file":
+			c.SetHeader("Content-Type", "text/plain")
+			http.ServeContent(c.ResponseWriter, c.Request, "", time.Time{}, strings.NewReader(text))
+			c.Handled = true
+		}
+	})
+	defer ts.Close()
+	ae := map[string]string{"Accept-Encoding": "gzip"}
+
+	resp := request(t, "GET", ts.URL+"/small", ae)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, "small", decode(t, resp))
+
+	resp = request(t, "GET", ts.URL+"/png", ae)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", resp.Header.Get("Vary"))
+	assert.Equal(t, text, decode(t, resp))
+
+	resp = request(t, "GET", ts.URL+"/encoded", ae)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, text, string(body))
+
+	resp = request(t, "GET", ts.URL+"/nocontent", ae)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	resp.Body.Close()
+
+	resp = request(t, "HEAD", ts.URL+"/small", ae)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, int64(len("small")), resp.ContentLength)
+	resp.Body.Close()
+
+	// a large body whose Content-Length is known is compressed, a partial one is not
+	resp = request(t, "GET", ts.URL+"/file", ae)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, text, decode(t, resp))
+	resp = request(t, "GET", ts.URL+"/file", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-4"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Hello", decode(t, resp))
+}
+
+func TestMinLength(t *testing.T) {
+	ts := testServer(Options{MinLength: -1}, func(c *goa.Context) {
+		c.SetHeader("ETag", `"etag"`)
+		c.String("small")
+	})
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `W/"etag"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "small", decode(t, resp))
+}
+
+func TestWriteDirectly(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		c.ResponseWriter.Write([]byte("direct"))
+		assert.True(t, c.Response().Written())
+		assert.False(t, c.Response().Committed())
+		assert.Equal(t, 6, c.Response().Size())
+		c.ResponseWriter.Write([]byte(text))
+		assert.True(t, c.Response().Committed())
+	})
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "direct"+text, decode(t, resp))
+}
+
+func TestError(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		c.ResponseWriter.Write([]byte("partial"))
+		c.Error(http.StatusBadRequest, "bad request")
+	})
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "bad request", decode(t, resp))
+}
+
+func TestSSE(t *testing.T) {
+	next := make(chan struct{})
+	ts := testServer(Options{}, func(c *goa.Context) {
+		stream := c.SSE()
+		stream.Send("", "", "first")
+		<-next
+		stream.Send("", "", "second")
+	})
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	gr, err := gzip.NewReader(resp.Body)
+	assert.Nil(t, err)
+	r := bufio.NewReader(gr)
+	line, _ := r.ReadString('\n')
+	assert.Equal(t, "data: first\n", line)
+	close(next)
+	r.ReadString('\n')
+	line, _ = r.ReadString('\n')
+	assert.Equal(t, "data: second\n", line)
+}
+
+func TestCompressible(t *testing.T) {
+	for ct, ok := range map[string]bool{
+		"":                         true,
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"image/svg+xml":            true,
+		"image/png":                false,
+		"video/mp4":                false,
+		"font/woff2":               false,
+		"application/zip":          false,
+		"application/GZIP":         false,
+		"invalid/type; charset=\"": false,
+	} {
+		assert.Equal(t, ok, Compressible(ct), ct)
+	}
+}
+
+func TestWrapHTTPMiddleware(t *testing.T) {
+	app := goa.New()
+	app.Use(goa.WrapHTTPMiddleware(func(next http.Handler) http.Handler {
+		return next
+	}))
+	app.Use(New(Options{}))
+	app.Use(func(c *goa.Context) {
+		if c.Path == "/small" {
+			c.String("small")
+			return
+		}
+		c.String(text)
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp := request(t, "GET", ts.URL, map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, text, decode(t, resp))
+
+	resp = request(t, "GET", ts.URL+"/small", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "small", decode(t, resp))
+}
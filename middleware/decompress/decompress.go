@@ -0,0 +1,161 @@
+// Package decompress implements a goa middleware which decompresses request bodies
+// encoded by gzip or deflate, so that the parsers read the original data.
+package decompress // import "github.com/goa-go/goa/middleware/decompress"
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/goa-go/goa"
+)
+
+// DefaultMaxSize is the default maximum size of a decompressed body, 32MB.
+const DefaultMaxSize = 32 << 20
+
+// Options is the options of the decompress middleware.
+type Options struct {
+	// MaxSize is the maximum size of a decompressed body, DefaultMaxSize by default.
+	// Reading more than it fails with goa.Error of 413, which blocks zip bombs.
+	MaxSize int64
+}
+
+// New returns the decompress middleware.
+// The body of a request with Content-Encoding gzip or deflate is replaced by the decompressed one,
+// Content-Encoding and Content-Length are removed.
+// Other encodings are refused by returning goa.Error of 415.
+// Errors of decompression are returned by reading the body, i.e. by the parsers,
+// a corrupt body is goa.Error of 400.
+// For example,
+// app.UseErr(decompress.New(decompress.Options{}))
+func New(opts Options) goa.ErrMiddleware {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+
+	return func(c *goa.Context) error {
+		var encodings []string
+		for _, value := range c.Header.Values("Content-Encoding") {
+			for _, e := range strings.Split(value, ",") {
+				e = strings.ToLower(strings.TrimSpace(e))
+				switch e {
+				case "", "identity":
+				case "gzip", "x-gzip", "deflate":
+					encodings = append(encodings, e)
+				default:
+					return goa.Error{
+						Code:   http.StatusUnsupportedMediaType,
+						Msg:    "unsupported Content-Encoding " + e,
+						Header: http.Header{"Accept-Encoding": {"gzip, deflate"}},
+					}
+				}
+			}
+		}
+		if len(encodings) == 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			return c.Next()
+		}
+
+		c.Request.Body = &body{
+			src:       c.Request.Body,
+			encodings: encodings,
+			remaining: opts.MaxSize,
+		}
+		c.Request.ContentLength = -1
+		c.Header.Del("Content-Encoding")
+		c.Header.Del("Content-Length")
+		return c.Next()
+	}
+}
+
+// body decompresses the source lazily, so errors are returned by Read.
+type body struct {
+	src       io.ReadCloser
+	encodings []string
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.r == nil {
+		if b.err = b.init(); b.err != nil {
+			return 0, b.err
+		}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// read one more byte to know whether the limit is exceeded
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.r.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		b.err = goa.Error{
+			Code: http.StatusRequestEntityTooLarge,
+			Msg:  "decompressed request body too large",
+		}
+		return n, b.err
+	}
+	b.remaining -= int64(n)
+
+	if err != nil && err != io.EOF {
+		b.err = invalid(err)
+		return n, b.err
+	}
+	return n, err
+}
+
+// init creates the decoders in the reverse order of the encodings applied.
+func (b *body) init() error {
+	var r io.Reader = b.src
+	for i := len(b.encodings) - 1; i >= 0; i-- {
+		var err error
+		switch b.encodings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r, err = newDeflateReader(r)
+		}
+		if err != nil {
+			return invalid(err)
+		}
+	}
+	b.r = r
+	return nil
+}
+
+func (b *body) Close() error {
+	return b.src.Close()
+}
+
+// newDeflateReader reads zlib-wrapped deflate as the spec, or raw deflate sent by some clients.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func invalid(err error) error {
+	return goa.Error{
+		Code:  http.StatusBadRequest,
+		Msg:   "invalid compressed request body",
+		Cause: err,
+	}
+}
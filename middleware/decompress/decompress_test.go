@@ -0,0 +1,167 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/goa-go/goa"
+	"github.com/stretchr/testify/assert"
+)
+
+type person struct {
+	Name string `json:"name" form:"name"`
+	Age  int    `json:"age" form:"age"`
+}
+
+func testServer(t *testing.T, opts Options) *httptest.Server {
+	app := goa.New()
+	app.UseErr(New(opts))
+	app.UseErr(func(c *goa.Context) error {
+		switch c.Path {
+		case "/json":
+			p := person{}
+			if err := c.ParseJSON(&p); err != nil {
+				return err
+			}
+			c.JSON(p)
+		case "/form":
+			p := person{}
+			if err := c.ParseForm(&p); err != nil {
+				return err
+			}
+			c.JSON(p)
+		default:
+			s, err := c.ParseString()
+			if err != nil {
+				return err
+			}
+			c.String(s)
+		}
+		return nil
+	})
+	return httptest.NewServer(app)
+}
+
+func encode(encoding string, data []byte) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	case "raw":
+		w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+	}
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func post(t *testing.T, url, ct, encoding string, body []byte) (*http.Response, string) {
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("Content-Encoding", encoding)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestDecompress(t *testing.T) {
+	ts := testServer(t, Options{})
+	defer ts.Close()
+
+	data := []byte(`{"name":"Nicholas","age":18}`)
+	for _, encoding := range []string{"gzip", "deflate", "raw"} {
+		ce := encoding
+		if encoding == "raw" {
+			ce = "deflate"
+		}
+		resp, body := post(t, ts.URL+"/json", "application/json", ce, encode(encoding, data))
+		assert.Equal(t, http.StatusOK, resp.StatusCode, encoding)
+		assert.Equal(t, string(data)+"\n", body, encoding)
+	}
+
+	form := url.Values{"name": {"Nicholas"}, "age": {"18"}}.Encode()
+	_, body := post(t, ts.URL+"/form", "application/x-www-form-urlencoded", "gzip", encode("gzip", []byte(form)))
+	assert.Equal(t, string(data)+"\n", body)
+
+	// applied in order
+	_, body = post(t, ts.URL, "text/plain", "deflate, gzip", encode("gzip", encode("deflate", []byte("twice"))))
+	assert.Equal(t, "twice", body)
+
+	_, body = post(t, ts.URL, "text/plain", "identity", []byte("plain"))
+	assert.Equal(t, "plain", body)
+	_, body = post(t, ts.URL, "text/plain", "", []byte("plain"))
+	assert.Equal(t, "plain", body)
+}
+
+func TestUnsupported(t *testing.T) {
+	ts := testServer(t, Options{})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL, "text/plain", "br", []byte("br"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	assert.Equal(t, "gzip, deflate", resp.Header.Get("Accept-Encoding"))
+	assert.Equal(t, "unsupported Content-Encoding br", body)
+}
+
+func TestUnsupportedReturned(t *testing.T) {
+	var err error
+	app := goa.New()
+	app.UseErr(func(c *goa.Context) error {
+		err = c.Next()
+		return err
+	})
+	app.UseErr(New(Options{}))
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, _ := post(t, ts.URL, "text/plain", "br", []byte("br"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	e, ok := err.(goa.Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnsupportedMediaType, e.Code)
+}
+
+func TestInvalid(t *testing.T) {
+	ts := testServer(t, Options{})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL, "text/plain", "gzip", []byte("not gzip"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid compressed request body", body)
+
+	truncated := encode("gzip", []byte(strings.Repeat("a", 1000)))
+	resp, _ = post(t, ts.URL, "text/plain", "gzip", truncated[:len(truncated)-10])
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = post(t, ts.URL, "text/plain", "deflate", []byte{0xff, 0xff, 0xff})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMaxSize(t *testing.T) {
+	ts := testServer(t, Options{MaxSize: 1024})
+	defer ts.Close()
+
+	bomb := encode("gzip", make([]byte, 10<<20))
+	assert.True(t, len(bomb) < 1<<20)
+	resp, body := post(t, ts.URL, "text/plain", "gzip", bomb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, "decompressed request body too large", body)
+
+	resp, body = post(t, ts.URL, "text/plain", "gzip", encode("gzip", bytes.Repeat([]byte("a"), 1024)))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1024, len(body))
+}
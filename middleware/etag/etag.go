@@ -0,0 +1,88 @@
+// Package etag implements a goa middleware which sets ETag of responses
+// and answers 304 Not Modified to fresh requests.
+package etag // import "github.com/goa-go/goa/middleware/etag"
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/goa-go/goa"
+	"github.com/goa-go/goa/responser"
+)
+
+// Options is the options of the etag middleware.
+type Options struct {
+	// Weak generates weak ETags, W/"...".
+	Weak bool
+}
+
+// New returns the etag middleware.
+// After the downstream, it hashes the output of the responser to set ETag,
+// unless ETag has been set, and turns a fresh request into a bodiless 304.
+// Streams, files and responses written directly are skipped.
+// For example,
+// app.Use(etag.New(etag.Options{}))
+func New(opts Options) goa.Middleware {
+	return func(c *goa.Context) {
+		if err := c.Next(); err != nil {
+			return
+		}
+
+		r := c.Responser()
+		if r == nil || c.Response().Written() {
+			return
+		}
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			return
+		}
+		if status := c.GetStatus(); status < 200 || status >= 300 {
+			return
+		}
+
+		header := c.ResponseWriter.Header()
+		if header.Get("ETag") == "" {
+			switch r.(type) {
+			case responser.Reader, responser.Content, responser.NDJSON, responser.JSONArray:
+				return
+			}
+
+			w := &bufferWriter{header: make(http.Header)}
+			if err := r.Respond(w); err != nil {
+				return
+			}
+			header.Set("ETag", generate(w.Bytes(), opts.Weak))
+			c.SetResponser(responser.Bytes{Data: w.Bytes()})
+		}
+
+		if c.Fresh() {
+			c.Status(http.StatusNotModified)
+			c.SetBody(nil)
+		}
+	}
+}
+
+// generate returns the ETag of the body, "<length in hex>-<base64 sha1>".
+func generate(body []byte, weak bool) string {
+	hash := sha1.Sum(body)
+	tag := `"` + strconv.FormatInt(int64(len(body)), 16) + "-" +
+		base64.RawStdEncoding.EncodeToString(hash[:]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// bufferWriter records the output of a responser.
+type bufferWriter struct {
+	bytes.Buffer
+	header http.Header
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(int) {}
@@ -0,0 +1,97 @@
+package etag
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goa-go/goa"
+	"github.com/stretchr/testify/assert"
+)
+
+func testServer(opts Options, m goa.Middleware) *httptest.Server {
+	app := goa.New()
+	app.Use(New(opts))
+	app.Use(m)
+	return httptest.NewServer(app)
+}
+
+func get(t *testing.T, url, etag string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestETag(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		c.JSON(goa.M{"key": "value"})
+	})
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL, "")
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, generate([]byte("{\"key\":\"value\"}\n"), false), etag)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "{\"key\":\"value\"}\n", body)
+
+	resp, body = get(t, ts.URL, etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, "", body)
+
+	resp, _ = get(t, ts.URL, `"other"`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestWeakETag(t *testing.T) {
+	ts := testServer(Options{Weak: true}, func(c *goa.Context) {
+		c.String("weak")
+	})
+	defer ts.Close()
+
+	resp, _ := get(t, ts.URL, "")
+	assert.True(t, strings.HasPrefix(resp.Header.Get("ETag"), `W/"4-`))
+}
+
+func TestCustomETag(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		c.SetHeader("ETag", `"v1"`)
+		c.String("custom")
+	})
+	defer ts.Close()
+
+	resp, _ := get(t, ts.URL, "")
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+
+	resp, _ = get(t, ts.URL, `"v1"`)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+func TestSkipETag(t *testing.T) {
+	ts := testServer(Options{}, func(c *goa.Context) {
+		switch c.Path {
+		case "/stream":
+			c.SetBody(strings.NewReader("stream"))
+		case "/error":
+			c.Status(http.StatusNotFound)
+			c.String("not found")
+		case "/direct":
+			c.ResponseWriter.Write([]byte("direct"))
+		}
+	})
+	defer ts.Close()
+
+	for _, path := range []string{"/stream", "/error", "/direct"} {
+		resp, _ := get(t, ts.URL+path, "")
+		assert.Equal(t, "", resp.Header.Get("ETag"))
+	}
+}
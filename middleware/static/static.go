@@ -0,0 +1,218 @@
+// Package static implements a goa middleware which serves static files from a fs.FS,
+// e.g. os.DirFS or embed.FS, like koa-static.
+package static // import "github.com/goa-go/goa/middleware/static"
+
+import (
+	"html"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/goa-go/goa"
+)
+
+// Options is the options of the static middleware.
+type Options struct {
+	// Index is the files served for a directory, ["index.html"] by default.
+	Index []string
+
+	// Browse lists the files of a directory which has no index file.
+	Browse bool
+
+	// Precompressed serves the sibling file "<name>.br" or "<name>.gz" if it exists,
+	// and the encoding is accepted by the request.
+	Precompressed bool
+
+	// Hidden serves the files and directories whose names begin with ".".
+	Hidden bool
+
+	// CacheControl sets Cache-Control of the files matched by the rules, the first match wins.
+	CacheControl []CacheRule
+
+	// Fallback is the file served for unknown paths which the downstream doesn't handle,
+	// e.g. "index.html" of a single page application.
+	// It's served only to GET and HEAD requests which accept text/html.
+	Fallback string
+}
+
+// CacheRule sets Cache-Control to Value for the files matched by Pattern.
+// Pattern is matched by path.Match against the file name relative to the root,
+// or against the base name if it contains no "/".
+// For example,
+// static.CacheRule{Pattern: "*.js", Value: "public, max-age=31536000, immutable"}
+type CacheRule struct {
+	Pattern string
+	Value   string
+}
+
+// encodings are the precompressed encodings and their extensions, in order of preference.
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// New returns the static middleware which serves the files in fsys.
+// Only GET and HEAD requests are served, the others and missing files fall through to the downstream.
+// A directory requested without the trailing slash is redirected to the path with it.
+// For example,
+// app.Use(static.New(os.DirFS("public"), static.Options{}))
+func New(fsys fs.FS, opts Options) goa.Middleware {
+	if opts.Index == nil {
+		opts.Index = []string{"index.html"}
+	}
+	s := &server{fsys: fsys, opts: opts}
+
+	return func(c *goa.Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		if s.serve(c) {
+			return
+		}
+		if err := c.Next(); err != nil {
+			return
+		}
+		if opts.Fallback != "" && s.unhandled(c) && c.Accepts("html") != "" {
+			s.serveFile(c, opts.Fallback)
+		}
+	}
+}
+
+type server struct {
+	fsys fs.FS
+	opts Options
+}
+
+// serve serves the file or directory at c.Path, and reports whether it's served.
+func (s *server) serve(c *goa.Context) bool {
+	name := strings.TrimPrefix(path.Clean("/"+c.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	if !s.opts.Hidden && hidden(name) {
+		return false
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return s.serveFile(c, name)
+	}
+
+	if !strings.HasSuffix(c.Path, "/") {
+		u := *c.URL
+		u.Path += "/"
+		c.Redirect(http.StatusMovedPermanently, u.String())
+		return true
+	}
+	for _, index := range s.opts.Index {
+		if s.serveFile(c, path.Join(name, index)) {
+			return true
+		}
+	}
+	if s.opts.Browse {
+		return s.browse(c, name)
+	}
+	return false
+}
+
+// serveFile serves the file, or its precompressed sibling, and reports whether it's served.
+func (s *server) serveFile(c *goa.Context, name string) bool {
+	ct := mime.TypeByExtension(path.Ext(name))
+
+	if s.opts.Precompressed && ct != "" {
+		for _, e := range encodings {
+			if c.AcceptsEncodings(e.name) == "" {
+				continue
+			}
+			if info, err := fs.Stat(s.fsys, name+e.ext); err != nil || info.IsDir() {
+				continue
+			}
+			if err := c.FileFS(s.fsys, name+e.ext); err != nil {
+				continue
+			}
+			c.SetContentType(ct)
+			c.SetHeader("Content-Encoding", e.name)
+			s.setHeaders(c, name, ct)
+			return true
+		}
+	}
+
+	if err := c.FileFS(s.fsys, name); err != nil {
+		return false
+	}
+	s.setHeaders(c, name, ct)
+	return true
+}
+
+func (s *server) setHeaders(c *goa.Context, name, ct string) {
+	if s.opts.Precompressed && ct != "" {
+		c.Response().Header().Add("Vary", "Accept-Encoding")
+	}
+	s.setCacheControl(c, name)
+}
+
+func (s *server) setCacheControl(c *goa.Context, name string) {
+	for _, rule := range s.opts.CacheControl {
+		pattern := name
+		if !strings.Contains(rule.Pattern, "/") {
+			pattern = path.Base(name)
+		}
+		if ok, _ := path.Match(rule.Pattern, pattern); ok {
+			c.SetHeader("Cache-Control", rule.Value)
+			return
+		}
+	}
+}
+
+// browse responds the list of the directory as HTML.
+func (s *server) browse(c *goa.Context, name string) bool {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return false
+	}
+
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		n := entry.Name()
+		if !s.opts.Hidden && strings.HasPrefix(n, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		b.WriteString("<a href=\"" + html.EscapeString(u.String()) + "\">" + html.EscapeString(n) + "</a>\n")
+	}
+	b.WriteString("</pre>\n")
+
+	c.HTML(b.String())
+	return true
+}
+
+// unhandled reports whether the downstream leaves the response as the default 404.
+func (s *server) unhandled(c *goa.Context) bool {
+	return !c.Handled && c.Responser() == nil && c.GetStatus() == http.StatusNotFound &&
+		!c.Response().Written()
+}
+
+// hidden reports whether any element of name begins with ".".
+func hidden(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if len(elem) > 1 && elem[0] == '.' {
+			return true
+		}
+	}
+	return false
+}
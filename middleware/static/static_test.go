@@ -0,0 +1,201 @@
+package static
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/goa-go/goa"
+	"github.com/stretchr/testify/assert"
+)
+
+var fsys = fstest.MapFS{
+	"index.html":        {Data: []byte("<h1>Home</h1>")},
+	"app.js":            {Data: []byte("console.log('goa')")},
+	"app.js.gz":         {Data: []byte("gzip")},
+	"app.js.br":         {Data: []byte("brotli")},
+	"style.css":         {Data: []byte("body{}")},
+	"docs/guide.md":     {Data: []byte("# Guide")},
+	"docs/a b.txt":      {Data: []byte("a b")},
+	"docs/.secret":      {Data: []byte("secret")},
+	".env":              {Data: []byte("KEY=value")},
+	"assets/logo.svg":   {Data: []byte("<svg/>")},
+	"empty/.gitkeep":    {Data: []byte("")},
+	"assets/index.html": {Data: []byte("<h1>Assets</h1>")},
+}
+
+func testServer(opts Options) *httptest.Server {
+	app := goa.New()
+	app.Use(New(fsys, opts))
+	app.Use(func(c *goa.Context) {
+		if c.Path == "/api" {
+			c.String("api")
+		}
+	})
+	return httptest.NewServer(app)
+}
+
+func get(t *testing.T, url string, header map[string]string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: &http.Transport{DisableCompression: true},
+	}
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestStatic(t *testing.T) {
+	ts := testServer(Options{})
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL+"/app.js", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "console.log('goa')", body)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "javascript")
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+
+	_, body = get(t, ts.URL+"/", nil)
+	assert.Equal(t, "<h1>Home</h1>", body)
+	_, body = get(t, ts.URL+"/assets/", nil)
+	assert.Equal(t, "<h1>Assets</h1>", body)
+
+	resp, _ = get(t, ts.URL+"/assets?v=1", nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/assets/?v=1", resp.Header.Get("Location"))
+
+	// fall through
+	resp, body = get(t, ts.URL+"/api", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "api", body)
+	resp, _ = get(t, ts.URL+"/missing.js", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, ts.URL+"/docs/", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// hidden
+	resp, _ = get(t, ts.URL+"/.env", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, ts.URL+"/docs/.secret", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStaticMethod(t *testing.T) {
+	ts := testServer(Options{})
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/app.js", "text/plain", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Head(ts.URL + "/app.js")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(len("console.log('goa')")), resp.ContentLength)
+}
+
+func TestStaticHidden(t *testing.T) {
+	ts := testServer(Options{Hidden: true})
+	defer ts.Close()
+
+	_, body := get(t, ts.URL+"/.env", nil)
+	assert.Equal(t, "KEY=value", body)
+}
+
+func TestStaticIndex(t *testing.T) {
+	ts := testServer(Options{Index: []string{"guide.md"}})
+	defer ts.Close()
+
+	_, body := get(t, ts.URL+"/docs/", nil)
+	assert.Equal(t, "# Guide", body)
+	resp, _ := get(t, ts.URL+"/", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestStaticBrowse(t *testing.T) {
+	ts := testServer(Options{Browse: true})
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL+"/docs/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<a href="a%20b.txt">a b.txt</a>`)
+	assert.Contains(t, body, `<a href="guide.md">guide.md</a>`)
+	assert.NotContains(t, body, ".secret")
+
+	// index wins
+	_, body = get(t, ts.URL+"/", nil)
+	assert.Equal(t, "<h1>Home</h1>", body)
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	ts := testServer(Options{Precompressed: true})
+	defer ts.Close()
+
+	resp, body := get(t, ts.URL+"/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal(t, "brotli", body)
+	assert.Equal(t, "br", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Contains(t, resp.Header.Get("Content-Type"), "javascript")
+
+	resp, body = get(t, ts.URL+"/app.js", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", body)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	resp, body = get(t, ts.URL+"/app.js", nil)
+	assert.Equal(t, "console.log('goa')", body)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+
+	// no sibling
+	resp, body = get(t, ts.URL+"/style.css", map[string]string{"Accept-Encoding": "gzip, br"})
+	assert.Equal(t, "body{}", body)
+	assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+}
+
+func TestStaticCacheControl(t *testing.T) {
+	ts := testServer(Options{CacheControl: []CacheRule{
+		{Pattern: "assets/*", Value: "public, max-age=86400"},
+		{Pattern: "*.js", Value: "public, max-age=31536000, immutable"},
+		{Pattern: "*", Value: "no-cache"},
+	}})
+	defer ts.Close()
+
+	resp, _ := get(t, ts.URL+"/app.js", nil)
+	assert.Equal(t, "public, max-age=31536000, immutable", resp.Header.Get("Cache-Control"))
+	resp, _ = get(t, ts.URL+"/assets/logo.svg", nil)
+	assert.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+	resp, _ = get(t, ts.URL+"/", nil)
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	resp, _ = get(t, ts.URL+"/api", nil)
+	assert.Equal(t, "", resp.Header.Get("Cache-Control"))
+}
+
+func TestStaticFallback(t *testing.T) {
+	ts := testServer(Options{Fallback: "index.html"})
+	defer ts.Close()
+
+	html := map[string]string{"Accept": "text/html,*/*;q=0.8"}
+	resp, body := get(t, ts.URL+"/users/1", html)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<h1>Home</h1>", body)
+
+	// the downstream wins
+	_, body = get(t, ts.URL+"/api", html)
+	assert.Equal(t, "api", body)
+
+	resp, _ = get(t, ts.URL+"/users/1", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
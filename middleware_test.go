@@ -1,6 +1,8 @@
 package goa
 
 import (
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -42,3 +44,135 @@ func TestMiddleware(t *testing.T) {
 
 	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, calls)
 }
+
+func TestErrMiddleware(t *testing.T) {
+	calls := []int{}
+	app := New()
+	app.Use(func(c *Context) {
+		calls = append(calls, 1)
+		c.Next()
+		calls = append(calls, 4)
+	})
+	app.UseErr(func(c *Context) error {
+		calls = append(calls, 2)
+		err := c.Next()
+		calls = append(calls, 3)
+		return err
+	})
+	app.UseErr(func(c *Context) error {
+		return Error{Code: 418, Msg: "teapot"}
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, []int{1, 2, 3, 4}, calls)
+	assert.Equal(t, 418, resp.StatusCode)
+	assert.Equal(t, "teapot", string(body))
+}
+
+func TestErrMiddlewareRecover(t *testing.T) {
+	app := New()
+	app.UseErr(func(c *Context) error {
+		if err := c.Next(); err != nil {
+			c.Status(http.StatusAccepted)
+			c.String("recovered: " + err.Error())
+		}
+		return nil
+	})
+	app.Use(func(c *Context) {
+		c.Next()
+	})
+	app.UseErr(func(c *Context) error {
+		return errors.New("error")
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "recovered: error", string(body))
+}
+
+func TestManyMiddlewares(t *testing.T) {
+	count := 0
+	app := New()
+	for i := 0; i < 300; i++ {
+		app.Use(func(c *Context) {
+			count++
+			c.Next()
+		})
+	}
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, 300, count)
+}
+
+func TestRun(t *testing.T) {
+	calls := []int{}
+	handlers := []ErrMiddleware{
+		func(c *Context) error {
+			calls = append(calls, 2)
+			return c.Next()
+		},
+		func(c *Context) error {
+			calls = append(calls, 3)
+			return c.Next()
+		},
+	}
+	app := New()
+	app.UseErr(func(c *Context) error {
+		calls = append(calls, 1)
+		return c.Run(handlers)
+	})
+	app.UseErr(func(c *Context) error {
+		calls = append(calls, 4)
+		return c.Run(nil)
+	})
+	app.Use(func(c *Context) {
+		calls = append(calls, 5)
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, calls)
+}
+
+func TestRewriteBody(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.Next()
+		if c.ContentType() == "application/json; charset=utf-8" {
+			c.SetBody(M{"data": c.Body()})
+		}
+	})
+	app.Use(func(c *Context) {
+		c.JSON(M{"key": "value"})
+	})
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, "{\"data\":{\"key\":\"value\"}}\n", string(body))
+}
@@ -0,0 +1,215 @@
+package goa
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Accepts returns the best of the types accepted by the request, or "" if none is acceptable.
+// A type can be a MIME type or an extension, e.g. "application/json" or "json",
+// the first one is returned if there is no Accept header.
+// For example,
+// switch c.Accepts("json", "html") {
+// case "json":
+//   c.JSON(data)
+// case "html":
+//   c.HTML(page)
+// }
+func (c *Context) Accepts(types ...string) string {
+	return negotiate(c.Request.Header.Get("Accept"), types, false, matchType)
+}
+
+// AcceptsEncodings returns the best of the encodings accepted by the request, or "" if none is acceptable.
+// "identity" is acceptable unless it's refused explicitly,
+// it's the only acceptable encoding if there is no Accept-Encoding header.
+func (c *Context) AcceptsEncodings(encodings ...string) string {
+	header := c.Request.Header.Get("Accept-Encoding")
+	if header == "" {
+		header = "identity"
+	}
+	return negotiate(header, encodings, true, matchToken)
+}
+
+// AcceptsCharsets returns the best of the charsets accepted by the request, or "" if none is acceptable.
+// The first one is returned if there is no Accept-Charset header.
+func (c *Context) AcceptsCharsets(charsets ...string) string {
+	return negotiate(c.Request.Header.Get("Accept-Charset"), charsets, false, matchToken)
+}
+
+// AcceptsLanguages returns the best of the languages accepted by the request, or "" if none is acceptable.
+// "en" in Accept-Language accepts "en-US" as well.
+// The first one is returned if there is no Accept-Language header.
+func (c *Context) AcceptsLanguages(languages ...string) string {
+	return negotiate(c.Request.Header.Get("Accept-Language"), languages, false, matchLanguage)
+}
+
+// Offer is a type offered to c.Negotiate with the function responding it.
+type Offer struct {
+	Type    string
+	Respond func()
+}
+
+// Negotiate calls the function of the best type accepted by the request,
+// the types are the same as c.Accepts, it throws 406 if none is acceptable.
+// The offers are in the order of preference, e.g. the first one is chosen for "*/*".
+// For example,
+// c.Negotiate(
+//   goa.Offer{Type: "json", Respond: func() { c.JSON(data) }},
+//   goa.Offer{Type: "html", Respond: func() { c.HTML(page) }},
+// )
+func (c *Context) Negotiate(offers ...Offer) {
+	types := make([]string, len(offers))
+	for i, offer := range offers {
+		types[i] = offer.Type
+	}
+
+	if t := c.Accepts(types...); t != "" {
+		for _, offer := range offers {
+			if offer.Type == t {
+				offer.Respond()
+				return
+			}
+		}
+	}
+	c.Error(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+}
+
+// acceptSpec is a value of Accept-like headers with its quality.
+type acceptSpec struct {
+	value string
+	q     float64
+}
+
+func parseAccept(header string) []acceptSpec {
+	specs := []acceptSpec{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+
+		spec := acceptSpec{value: value, q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+					spec.q = q
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// negotiate returns the offer with the highest quality,
+// the quality of an offer is given by its most specific matching spec.
+// Ties are broken by the specificity, the order of the specs, and then the order of the offers.
+func negotiate(header string, offers []string, identity bool, match func(spec, offer string) int) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if header == "" {
+		return offers[0]
+	}
+
+	specs := parseAccept(header)
+	if identity {
+		specs = withIdentity(specs)
+	}
+
+	best := ""
+	bestQ, bestS, bestOrder := 0.0, -1, len(specs)
+	for _, offer := range offers {
+		q, s, order := 0.0, -1, len(specs)
+		for i, spec := range specs {
+			if sp := match(spec.value, offer); sp > s {
+				q, s, order = spec.q, sp, i
+			}
+		}
+
+		if q > bestQ || (q == bestQ && q > 0 && (s > bestS || (s == bestS && order < bestOrder))) {
+			best, bestQ, bestS, bestOrder = offer, q, s, order
+		}
+	}
+	return best
+}
+
+// withIdentity adds "identity" to Accept-Encoding specs with the lowest quality,
+// unless it's specified or matched by "*".
+func withIdentity(specs []acceptSpec) []acceptSpec {
+	minQ := 1.0
+	for _, spec := range specs {
+		if spec.value == "identity" || spec.value == "*" {
+			return specs
+		}
+		if spec.q < minQ {
+			minQ = spec.q
+		}
+	}
+	return append(specs, acceptSpec{value: "identity", q: minQ})
+}
+
+var shortTypes = map[string]string{
+	"html": "text/html",
+	"text": "text/plain",
+	"txt":  "text/plain",
+	"json": "application/json",
+	"xml":  "application/xml",
+}
+
+// mimeType returns the MIME type of a type offered to c.Accepts.
+func mimeType(t string) string {
+	t = strings.ToLower(t)
+	if strings.Contains(t, "/") {
+		return t
+	}
+	if mt, ok := shortTypes[t]; ok {
+		return mt
+	}
+	mt, _, _ := mime.ParseMediaType(mime.TypeByExtension("." + t))
+	return mt
+}
+
+func matchType(spec, offer string) int {
+	offer = mimeType(offer)
+	if offer == "" {
+		return -1
+	}
+
+	switch {
+	case spec == offer:
+		return 2
+	case spec == "*/*":
+		return 0
+	case strings.HasSuffix(spec, "/*") && strings.HasPrefix(offer, spec[:len(spec)-1]):
+		return 1
+	}
+	return -1
+}
+
+func matchToken(spec, offer string) int {
+	if strings.EqualFold(spec, offer) {
+		return 1
+	}
+	if spec == "*" {
+		return 0
+	}
+	return -1
+}
+
+func matchLanguage(spec, offer string) int {
+	offer = strings.ToLower(offer)
+	switch {
+	case spec == offer:
+		return 2
+	case strings.HasPrefix(offer, spec+"-"):
+		return 1
+	case spec == "*":
+		return 0
+	}
+	return -1
+}
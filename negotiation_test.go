@@ -0,0 +1,114 @@
+package goa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func acceptContext(key, value string) *Context {
+	c := &Context{}
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	if value != "" {
+		c.Request.Header.Set(key, value)
+	}
+	return c
+}
+
+func TestAccepts(t *testing.T) {
+	c := acceptContext("Accept", "")
+	assert.Equal(t, "json", c.Accepts("json", "html"))
+
+	c = acceptContext("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(t, "html", c.Accepts("json", "html"))
+	assert.Equal(t, "xml", c.Accepts("json", "xml"))
+	assert.Equal(t, "json", c.Accepts("json"))
+	assert.Equal(t, "text/html", c.Accepts("text/html"))
+
+	c = acceptContext("Accept", "application/json, text/*;q=0.5")
+	assert.Equal(t, "json", c.Accepts("html", "json"))
+	assert.Equal(t, "text", c.Accepts("text", "xml"))
+	assert.Equal(t, "", c.Accepts("xml", "png"))
+
+	c = acceptContext("Accept", "text/html;q=0, */*")
+	assert.Equal(t, "json", c.Accepts("html", "json"))
+
+	c = acceptContext("Accept", "image/*")
+	assert.Equal(t, "png", c.Accepts("json", "png"))
+}
+
+func TestAcceptsEncodings(t *testing.T) {
+	c := acceptContext("Accept-Encoding", "")
+	assert.Equal(t, "identity", c.AcceptsEncodings("gzip", "identity"))
+	assert.Equal(t, "", c.AcceptsEncodings("gzip"))
+
+	c = acceptContext("Accept-Encoding", "gzip, deflate, br;q=1.0")
+	assert.Equal(t, "gzip", c.AcceptsEncodings("gzip", "br", "identity"))
+	assert.Equal(t, "gzip", c.AcceptsEncodings("br", "gzip"))
+	assert.Equal(t, "identity", c.AcceptsEncodings("zstd", "identity"))
+
+	c = acceptContext("Accept-Encoding", "gzip;q=0.5, br")
+	assert.Equal(t, "br", c.AcceptsEncodings("gzip", "br"))
+
+	c = acceptContext("Accept-Encoding", "gzip, identity;q=0")
+	assert.Equal(t, "", c.AcceptsEncodings("identity"))
+
+	c = acceptContext("Accept-Encoding", "*")
+	assert.Equal(t, "zstd", c.AcceptsEncodings("zstd"))
+}
+
+func TestAcceptsCharsets(t *testing.T) {
+	c := acceptContext("Accept-Charset", "utf-8, iso-8859-1;q=0.5")
+	assert.Equal(t, "UTF-8", c.AcceptsCharsets("iso-8859-1", "UTF-8"))
+	assert.Equal(t, "iso-8859-1", c.AcceptsCharsets("iso-8859-1", "gbk"))
+	assert.Equal(t, "", c.AcceptsCharsets("gbk"))
+}
+
+func TestAcceptsLanguages(t *testing.T) {
+	c := acceptContext("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	assert.Equal(t, "zh-CN", c.AcceptsLanguages("en", "zh-CN"))
+	assert.Equal(t, "zh-TW", c.AcceptsLanguages("en-US", "zh-TW"))
+	assert.Equal(t, "en-US", c.AcceptsLanguages("fr", "en-US"))
+	assert.Equal(t, "", c.AcceptsLanguages("fr"))
+}
+
+func TestNegotiate(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.Negotiate(
+			Offer{Type: "json", Respond: func() { c.JSON(M{"key": "value"}) }},
+			Offer{Type: "html", Respond: func() { c.HTML("<p>value</p>") }},
+		)
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	get := func(accept string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("application/json")
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "{\"key\":\"value\"}\n", body)
+
+	resp, body = get("text/html")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "<p>value</p>", body)
+
+	// the first offer is preferred when the client accepts anything
+	resp, body = get("*/*")
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "{\"key\":\"value\"}\n", body)
+
+	resp, _ = get("image/png")
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
@@ -0,0 +1,167 @@
+package goa
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter is the http.ResponseWriter wrapped by goa,
+// which tracks the status and the size of the response.
+// Flusher, Hijacker and Pusher are passed through to the original writer.
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+
+	// Status returns the status code written, or 0 if it's not written.
+	Status() int
+
+	// Size returns the number of bytes of the body written.
+	Size() int
+
+	// Written reports whether the status or body has been written.
+	Written() bool
+
+	// Committed reports whether the headers have been sent to the client,
+	// headers can't be changed after that.
+	Committed() bool
+
+	// Buffer buffers the status and body until the response is finished or flushed,
+	// so that upstream middlewares can still change the headers and status.
+	Buffer()
+
+	// Reset discards the buffered status and body, it reports whether it succeeded.
+	Reset() bool
+
+	// Unwrap returns the original http.ResponseWriter.
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+
+	status    int
+	size      int
+	committed bool
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (w *responseWriter) reset(rw http.ResponseWriter) {
+	w.ResponseWriter = rw
+	w.status = 0
+	w.size = 0
+	w.committed = false
+	w.buffering = false
+	w.buf.Reset()
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *responseWriter) Committed() bool {
+	return w.committed
+}
+
+func (w *responseWriter) Buffer() {
+	if !w.committed {
+		w.buffering = true
+	}
+}
+
+func (w *responseWriter) Reset() bool {
+	if w.committed {
+		return false
+	}
+	w.status = 0
+	w.size = 0
+	w.buf.Reset()
+	return true
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader writes the status code, while buffering it can be overwritten.
+func (w *responseWriter) WriteHeader(code int) {
+	if w.committed {
+		return
+	}
+	w.status = code
+	if !w.buffering {
+		w.commit()
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.Written() {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.size += len(b)
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) commit() {
+	w.committed = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// finish sends the buffered response.
+func (w *responseWriter) finish() error {
+	w.buffering = false
+	if w.committed || !w.Written() {
+		return nil
+	}
+	w.commit()
+	_, err := w.buf.WriteTo(w.ResponseWriter)
+	return err
+}
+
+// Flush sends the buffered response and stops buffering, then flushes the original writer.
+func (w *responseWriter) Flush() {
+	if w.buffering {
+		w.finish()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("goa: the ResponseWriter doesn't implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.committed = true
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
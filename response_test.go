@@ -0,0 +1,193 @@
+package goa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &responseWriter{}
+	w.reset(rec)
+
+	assert.False(t, w.Written())
+	assert.Equal(t, 0, w.Status())
+
+	w.Write([]byte("body"))
+	assert.True(t, w.Written())
+	assert.True(t, w.Committed())
+	assert.Equal(t, http.StatusOK, w.Status())
+	assert.Equal(t, 4, w.Size())
+	assert.False(t, w.Reset())
+
+	w.WriteHeader(http.StatusCreated)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, rec, w.Unwrap())
+}
+
+func TestResponseWriterBuffer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &responseWriter{}
+	w.reset(rec)
+	w.Buffer()
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("buffered"))
+	assert.True(t, w.Written())
+	assert.False(t, w.Committed())
+	assert.Equal(t, "", rec.Body.String())
+
+	w.Header().Set("X-Late", "1")
+	w.WriteHeader(http.StatusAccepted)
+	assert.Nil(t, w.finish())
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Late"))
+	assert.Equal(t, "buffered", rec.Body.String())
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &responseWriter{}
+	w.reset(rec)
+	w.Buffer()
+
+	w.Write([]byte("flushed"))
+	w.Flush()
+
+	assert.True(t, rec.Flushed)
+	assert.True(t, w.Committed())
+	assert.Equal(t, "flushed", rec.Body.String())
+
+	w.Write([]byte(" directly"))
+	assert.Equal(t, "flushed directly", rec.Body.String())
+}
+
+func TestResponseWriterNotSupported(t *testing.T) {
+	w := &responseWriter{}
+	w.reset(httptest.NewRecorder())
+
+	_, _, err := w.Hijack()
+	assert.Error(t, err)
+	assert.Equal(t, http.ErrNotSupported, w.Push("/style.css", nil))
+}
+
+func TestWriteDirectly(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		c.ResponseWriter.WriteHeader(http.StatusCreated)
+		c.ResponseWriter.Write([]byte("directly"))
+	})
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "directly", string(body))
+}
+
+func TestBufferedResponse(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.Response().Buffer()
+		c.Next()
+		c.SetHeader("X-Size", "8")
+		c.ResponseWriter.WriteHeader(http.StatusAccepted)
+	})
+	app.Use(func(c *Context) {
+		c.ResponseWriter.Write([]byte("buffered"))
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "8", resp.Header.Get("X-Size"))
+	assert.Equal(t, "buffered", string(body))
+}
+
+func TestBufferedError(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		c.Response().Buffer()
+		c.ResponseWriter.Write([]byte("partial"))
+		c.Error(http.StatusBadRequest, "bad request")
+	})
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "bad request", string(body))
+}
+
+func TestSetHeaderAfterSent(t *testing.T) {
+	buf := new(bytes.Buffer)
+	app := New()
+	app.ErrorLog = log.New(buf, "", 0)
+	app.Use(func(c *Context) {
+		c.ResponseWriter.Write([]byte("sent"))
+		c.SetHeader("X-Late", "1")
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "", resp.Header.Get("X-Late"))
+	assert.Equal(t, "[WARN] goa: header X-Late is set after the headers are sent\n", buf.String())
+}
+
+// upperWriter is a ResponseWriter wrapped by a middleware, which buffers the body until it's closed.
+type upperWriter struct {
+	ResponseWriter
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *upperWriter) Write(b []byte) (int, error) {
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	return w.buf.Write(bytes.ToUpper(b))
+}
+
+func (w *upperWriter) Close() error {
+	w.closed = true
+	_, err := w.buf.WriteTo(w.ResponseWriter)
+	return err
+}
+
+func TestWrappedResponseWriter(t *testing.T) {
+	var wrapped *upperWriter
+	ts := testServer(func(c *Context) {
+		wrapped = &upperWriter{ResponseWriter: c.Response()}
+		c.ResponseWriter = wrapped
+		c.OnFinish(wrapped.Close)
+		assert.Equal(t, wrapped, c.Response())
+		c.String("wrapped")
+	})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.True(t, wrapped.closed)
+	assert.Equal(t, "WRAPPED", string(body))
+}
@@ -0,0 +1,16 @@
+package responser
+
+import (
+	"net/http"
+)
+
+// Bytes is a bytes-responser instance.
+type Bytes struct {
+	Data []byte
+}
+
+// Respond bytes-data.
+func (r Bytes) Respond(w http.ResponseWriter) error {
+	_, err := w.Write(r.Data)
+	return err
+}
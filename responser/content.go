@@ -0,0 +1,26 @@
+package responser
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Content is a seekable-content-responser instance, it's served by http.ServeContent,
+// which supports Range requests and conditional requests,
+// and writes the status and headers by itself.
+type Content struct {
+	Request *http.Request
+	Name    string
+	ModTime time.Time
+	Data    io.ReadSeeker
+}
+
+// Respond serves the content, it's closed if it's an io.Closer.
+func (r Content) Respond(w http.ResponseWriter) error {
+	if closer, ok := r.Data.(io.Closer); ok {
+		defer closer.Close()
+	}
+	http.ServeContent(w, r.Request, r.Name, r.ModTime, r.Data)
+	return nil
+}
@@ -0,0 +1,20 @@
+package responser
+
+import (
+	"io"
+	"net/http"
+)
+
+// Reader is a stream-responser instance.
+type Reader struct {
+	Data io.Reader
+}
+
+// Respond copies data from the reader, it's closed if it's an io.Closer.
+func (r Reader) Respond(w http.ResponseWriter) error {
+	if closer, ok := r.Data.(io.Closer); ok {
+		defer closer.Close()
+	}
+	_, err := io.Copy(w, r.Data)
+	return err
+}
@@ -1,10 +1,15 @@
 package responser
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"io"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -82,3 +87,144 @@ func TestRespondString(t *testing.T) {
 // 		t.Errorf("respond string failed: %v", string(body))
 // 	}
 // }
+
+func TestRespondBytes(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Bytes{Data: []byte("bytes")}.Respond(w)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "bytes", w.Body.String())
+}
+
+type closer struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRespondReader(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := &closer{Reader: strings.NewReader("reader")}
+	err := Reader{Data: r}.Respond(w)
+
+	assert.Nil(t, err)
+	assert.True(t, r.closed)
+	assert.Equal(t, "reader", w.Body.String())
+}
+
+func TestRespondContent(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	err := Content{Request: req, Name: "a.txt", Data: strings.NewReader("content")}.Respond(w)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, "cont", w.Body.String())
+}
+
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []string
+}
+
+func (w *flushRecorder) Flush() {
+	w.flushes = append(w.flushes, w.Body.String())
+}
+
+func TestRespondNDJSON(t *testing.T) {
+	ch := make(chan person, 2)
+	ch <- person{ID: 1, FirstName: "Nicholas"}
+	ch <- person{ID: 2, FirstName: "Cao"}
+	close(ch)
+
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	err := NDJSON{Data: ch}.Respond(w)
+
+	line1, _ := json.Marshal(person{ID: 1, FirstName: "Nicholas"})
+	line2, _ := json.Marshal(person{ID: 2, FirstName: "Cao"})
+	assert.Nil(t, err)
+	assert.Equal(t, string(line1)+"\n"+string(line2)+"\n", w.Body.String())
+	assert.Equal(t, []string{string(line1) + "\n", w.Body.String()}, w.flushes)
+}
+
+func TestRespondNDJSONIterator(t *testing.T) {
+	i := 0
+	next := func() (interface{}, bool) {
+		i++
+		return i, i <= 3
+	}
+	w := httptest.NewRecorder()
+	assert.Nil(t, NDJSON{Data: next}.Respond(w))
+	assert.Equal(t, "1\n2\n3\n", w.Body.String())
+
+	i = 0
+	failed := errors.New("failed")
+	nextErr := func() (interface{}, error) {
+		i++
+		if i > 2 {
+			return nil, failed
+		}
+		return i, nil
+	}
+	w = httptest.NewRecorder()
+	assert.Equal(t, failed, NDJSON{Data: nextErr}.Respond(w))
+	assert.Equal(t, "1\n2\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	assert.EqualError(t, NDJSON{Data: []int{1}}.Respond(w), "responser: []int is neither a channel nor an iterator")
+	assert.Error(t, NDJSON{Data: make(chan<- int)}.Respond(w))
+}
+
+func TestRespondNDJSONCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan int, 1)
+	ch <- 1
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	// the channel is never closed
+	w := httptest.NewRecorder()
+	assert.Equal(t, context.Canceled, NDJSON{Context: ctx, Data: ch}.Respond(w))
+	assert.Equal(t, "1\n", w.Body.String())
+
+	next := func() (interface{}, bool) {
+		return 1, true
+	}
+	w = httptest.NewRecorder()
+	assert.Equal(t, context.Canceled, JSONArray{Context: ctx, Data: next}.Respond(w))
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestRespondJSONArray(t *testing.T) {
+	i := 0
+	next := func() (interface{}, error) {
+		i++
+		if i > 3 {
+			return nil, io.EOF
+		}
+		return map[string]int{"i": i}, nil
+	}
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	err := JSONArray{Data: next}.Respond(w)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "[{\"i\":1},{\"i\":2},{\"i\":3}]\n", w.Body.String())
+	assert.Equal(t, []string{"[{\"i\":1}", "[{\"i\":1},{\"i\":2}", "[{\"i\":1},{\"i\":2},{\"i\":3}"}, w.flushes)
+
+	var result []map[string]int
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Len(t, result, 3)
+
+	ch := make(chan string)
+	close(ch)
+	w2 := httptest.NewRecorder()
+	assert.Nil(t, JSONArray{Data: ch}.Respond(w2))
+	assert.Equal(t, "[]\n", w2.Body.String())
+}
@@ -0,0 +1,139 @@
+package responser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// NDJSON is a newline-delimited-json-responser instance, every element is a line.
+// Data is a channel, or an iterator func() (interface{}, bool) or func() (interface{}, error),
+// which ends with false or io.EOF.
+// The elements are encoded and flushed one by one, so they are never all in memory.
+// The stream stops with the error of Context once it's done, e.g. the client disconnects,
+// a channel is waited on together with it, an iterator is checked between the elements.
+type NDJSON struct {
+	Context context.Context
+	Data    interface{}
+}
+
+// Respond encodes and flushes the elements until the data ends.
+func (r NDJSON) Respond(w http.ResponseWriter) error {
+	e := json.NewEncoder(w)
+	return iterate(r.Context, r.Data, func(v interface{}) error {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+		flush(w)
+		return nil
+	})
+}
+
+// JSONArray is a streaming-json-array-responser instance,
+// Context and Data are the same as NDJSON, the elements are encoded and flushed as a JSON array.
+type JSONArray struct {
+	Context context.Context
+	Data    interface{}
+}
+
+// Respond encodes and flushes the elements until the data ends.
+func (r JSONArray) Respond(w http.ResponseWriter) error {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	b.WriteByte('[')
+
+	err := iterate(r.Context, r.Data, func(v interface{}) error {
+		// b holds "[" before the first element, and is drained after every element
+		if b.Len() == 0 {
+			b.WriteByte(',')
+		}
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+		// the newline written by Encode
+		b.Truncate(b.Len() - 1)
+		if _, err := b.WriteTo(w); err != nil {
+			return err
+		}
+		flush(w)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.WriteString("]\n")
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// iterate calls f with the elements of the channel or iterator until ctx is done.
+func iterate(ctx context.Context, data interface{}, f func(interface{}) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	switch next := data.(type) {
+	case func() (interface{}, bool):
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			v, ok := next()
+			if !ok {
+				return nil
+			}
+			if err := f(v); err != nil {
+				return err
+			}
+		}
+	case func() (interface{}, error):
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			v, err := next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := f(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	ch := reflect.ValueOf(data)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return fmt.Errorf("responser: %T is neither a channel nor an iterator", data)
+	}
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: ch}}
+	if done := ctx.Done(); done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if err := f(v.Interface()); err != nil {
+			return err
+		}
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
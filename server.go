@@ -0,0 +1,281 @@
+package goa
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Server returns the *http.Server used by app.Listen.
+// It can be configured (timeouts, ErrorLog, etc.) before listening.
+func (app *Goa) Server() *http.Server {
+	app.serverOnce.Do(func() {
+		app.server = &http.Server{Handler: app}
+		app.shutdown = make(chan struct{})
+		app.done = make(chan struct{})
+	})
+	return app.server
+}
+
+// OnStart registers a hook which is called before the server starts listening,
+// if a hook returns an error, the server will not start.
+func (app *Goa) OnStart(hook func() error) {
+	app.onStart = append(app.onStart, hook)
+}
+
+// OnShutdown registers a hook which is called after the in-flight requests
+// have been drained, it's the place to flush buffers and close DB pools.
+// The hooks get the context of app.Shutdown, or a new one with app.ShutdownTimeout
+// if it has expired while draining.
+func (app *Goa) OnShutdown(hook func(context.Context) error) {
+	app.onShutdown = append(app.onShutdown, hook)
+}
+
+// Listen starts server with the addr.
+// It blocks until the server is closed,
+// after a graceful shutdown it waits for app.Shutdown to finish and returns its error.
+// If the server is closed otherwise, e.g. by app.Server().Close(), http.ErrServerClosed is returned.
+func (app *Goa) Listen(addr string) error {
+	srv := app.Server()
+	srv.Addr = addr
+	return app.serve(srv.ListenAndServe)
+}
+
+// ListenUnix starts server on the unix domain socket path,
+// the socket file is created with the mode, a stale one is removed first.
+func (app *Goa) ListenUnix(path string, mode os.FileMode) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return err
+	}
+	return app.Serve(l)
+}
+
+// ListenFD starts server on an inherited listener file descriptor,
+// e.g. 3 for the first socket passed by systemd socket activation.
+func (app *Goa) ListenFD(fd uintptr) error {
+	f := os.NewFile(fd, "listener")
+	if f == nil {
+		return fmt.Errorf("invalid file descriptor: %d", fd)
+	}
+	l, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return app.Serve(l)
+}
+
+// Serve accepts incoming connections on the listener l.
+// It blocks like app.Listen, the listener is closed when Serve returns.
+func (app *Goa) Serve(l net.Listener) error {
+	srv := app.Server()
+	return app.serve(func() error {
+		return srv.Serve(l)
+	})
+}
+
+func (app *Goa) serve(listen func() error) error {
+	for _, hook := range app.onStart {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+
+	err := listen()
+	if err != http.ErrServerClosed {
+		return err
+	}
+	select {
+	case <-app.shutdown:
+		<-app.done
+		return app.shutdownErr
+	default:
+		return err
+	}
+}
+
+// Shutdown gracefully shuts down the server, it stops accepting new connections,
+// waits for in-flight requests and then runs the OnShutdown hooks.
+// If ctx expires before the requests are drained, the remaining connections are closed.
+func (app *Goa) Shutdown(ctx context.Context) error {
+	srv := app.Server()
+	app.shutdownOnce.Do(func() {
+		close(app.shutdown)
+		defer close(app.done)
+
+		err := srv.Shutdown(ctx)
+		if err == nil {
+			// h2c connections are hijacked, srv.Shutdown doesn't wait for them
+			err = app.hijacked.wait(ctx)
+		}
+		if err != nil {
+			app.shutdownErr = err
+			srv.Close()
+		}
+		// the hooks still get to clean up after a drain timeout
+		if ctx.Err() != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = app.shutdownContext()
+			defer cancel()
+		}
+		for _, hook := range app.onShutdown {
+			if err := hook(ctx); err != nil && app.shutdownErr == nil {
+				app.shutdownErr = err
+			}
+		}
+	})
+	return app.shutdownErr
+}
+
+// ShutdownOnSignal shuts down the app gracefully when one of the signals is received,
+// using app.ShutdownTimeout as the drain timeout.
+// SIGINT and SIGTERM are used by default.
+func (app *Goa) ShutdownOnSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	go func() {
+		<-ch
+		signal.Stop(ch)
+
+		ctx, cancel := app.shutdownContext()
+		defer cancel()
+		if err := app.Shutdown(ctx); err != nil {
+			app.logf("[ERROR] %+v", err)
+		}
+	}()
+}
+
+// shutdownContext returns a context with app.ShutdownTimeout, or without a deadline if it's zero.
+func (app *Goa) shutdownContext() (context.Context, context.CancelFunc) {
+	if app.ShutdownTimeout > 0 {
+		return context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// CertProvider provides TLS certificates for app.ListenAutoTLS,
+// *autocert.Manager is a CertProvider for example.
+type CertProvider interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// CertProviderFunc is an adapter to use a function as CertProvider.
+type CertProviderFunc func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// GetCertificate calls f(hello).
+func (f CertProviderFunc) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f(hello)
+}
+
+// ListenTLS starts a HTTPS server with the addr, certFile and keyFile.
+// HTTP/2 is enabled automatically.
+func (app *Goa) ListenTLS(addr, certFile, keyFile string) error {
+	srv := app.Server()
+	srv.Addr = addr
+	app.initTLSConfig()
+	return app.serve(func() error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// ListenAutoTLS starts a HTTPS server with the addr,
+// certificates are obtained from the provider on each TLS handshake.
+// HTTP/2 is enabled automatically.
+func (app *Goa) ListenAutoTLS(addr string, provider CertProvider) error {
+	srv := app.Server()
+	srv.Addr = addr
+	app.initTLSConfig()
+	srv.TLSConfig.GetCertificate = provider.GetCertificate
+	return app.serve(func() error {
+		return srv.ListenAndServeTLS("", "")
+	})
+}
+
+// ListenH2C starts a server with the addr which accepts
+// cleartext HTTP/2 (h2c) as well as HTTP/1.x.
+func (app *Goa) ListenH2C(addr string) error {
+	srv := app.Server()
+	srv.Addr = addr
+	// srv.Shutdown sends GOAWAY to the h2c connections once h2s is configured
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return err
+	}
+	srv.Handler = h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			app.hijacked.add(1)
+			defer app.hijacked.add(-1)
+		}
+		app.ServeHTTP(w, r)
+	}), h2s)
+	return app.serve(srv.ListenAndServe)
+}
+
+// requestGroup counts the in-flight requests which http.Server doesn't track,
+// i.e. the requests on hijacked connections.
+type requestGroup struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed when n drops to 0
+}
+
+func (g *requestGroup) add(delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n += delta
+	if g.n == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// wait waits until no request is in flight or ctx is done.
+func (g *requestGroup) wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.n == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (app *Goa) initTLSConfig() {
+	srv := app.Server()
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+}
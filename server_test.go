@@ -0,0 +1,402 @@
+package goa
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// startServer serves app on a random port of the loopback,
+// it returns the address and the result of app.Serve.
+func startServer(t *testing.T, app *Goa) (string, <-chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.Serve(l)
+	}()
+	return l.Addr().String(), errc
+}
+
+// freeAddr returns a free address of the loopback for the methods which listen by themselves.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// get retries until the server started in another goroutine is listening.
+func get(client *http.Client, url string) (resp *http.Response, err error) {
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get(url); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return
+}
+
+func TestShutdown(t *testing.T) {
+	calls := []string{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app := New()
+	app.Use(func(c *Context) {
+		close(started)
+		<-release
+		c.String("drained")
+	})
+	app.OnStart(func() error {
+		calls = append(calls, "start")
+		return nil
+	})
+	app.OnShutdown(func(ctx context.Context) error {
+		calls = append(calls, "shutdown")
+		return nil
+	})
+	addr, errc := startServer(t, app)
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, _ := http.Get("http://" + addr)
+		respc <- resp
+	}()
+	<-started
+
+	shutdownc := make(chan error, 1)
+	go func() {
+		shutdownc <- app.Shutdown(context.Background())
+	}()
+	// the in-flight request is drained after the shutdown starts
+	<-app.shutdown
+	close(release)
+
+	assert.Nil(t, <-shutdownc)
+	assert.Nil(t, <-errc)
+	assert.Equal(t, []string{"start", "shutdown"}, calls)
+
+	resp := <-respc
+	if assert.NotNil(t, resp) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestShutdownH2C(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app := New()
+	app.Use(func(c *Context) {
+		if c.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		c.String("drained")
+	})
+	addr := freeAddr(t)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.ListenH2C(addr)
+	}()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	resp, err := get(client, "http://"+addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+	resp.Body.Close()
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, _ := client.Get("http://" + addr + "/slow")
+		respc <- resp
+	}()
+	<-started
+
+	shutdownc := make(chan error, 1)
+	go func() {
+		shutdownc <- app.Shutdown(context.Background())
+	}()
+	<-app.shutdown
+	select {
+	case <-shutdownc:
+		t.Fatal("app.Shutdown returns before the h2c request is drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	assert.Nil(t, <-shutdownc)
+	assert.Nil(t, <-errc)
+	resp = <-respc
+	if assert.NotNil(t, resp) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "drained", string(body))
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	app := New()
+	app.Use(func(c *Context) {
+		close(started)
+		<-release
+	})
+	hooked := false
+	var hookErr error
+	app.OnShutdown(func(ctx context.Context) error {
+		hooked, hookErr = true, ctx.Err()
+		return nil
+	})
+	addr, errc := startServer(t, app)
+	go http.Get("http://" + addr)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, app.Shutdown(ctx))
+	assert.Equal(t, context.DeadlineExceeded, <-errc)
+	// the hook gets a context which isn't expired
+	assert.True(t, hooked)
+	assert.Nil(t, hookErr)
+}
+
+func TestShutdownHookError(t *testing.T) {
+	app := New()
+	app.OnShutdown(func(ctx context.Context) error {
+		return errors.New("close db")
+	})
+
+	assert.EqualError(t, app.Shutdown(context.Background()), "close db")
+	assert.EqualError(t, app.Shutdown(context.Background()), "close db")
+}
+
+func TestStartHookError(t *testing.T) {
+	app := New()
+	app.OnStart(func() error {
+		return errors.New("open db")
+	})
+	defer app.Shutdown(context.Background())
+
+	assert.EqualError(t, app.Listen("127.0.0.1:0"), "open db")
+}
+
+// chanWriter sends every write to the channel, e.g. to wait for a log.
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	logs := make(chanWriter, 1)
+	app := New()
+	app.ErrorLog = log.New(logs, "", 0)
+	app.ShutdownTimeout = time.Second
+	app.OnShutdown(func(ctx context.Context) error {
+		return errors.New("close db")
+	})
+	app.ShutdownOnSignal(syscall.SIGUSR1)
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case line := <-logs:
+		assert.Equal(t, "[ERROR] close db\n", line)
+	case <-time.After(time.Second):
+		t.Fatal("app was not shut down")
+	}
+}
+
+func TestListenTLSFailed(t *testing.T) {
+	app := New()
+	defer app.Shutdown(context.Background())
+	assert.Error(t, app.ListenTLS("127.0.0.1:0", "no-cert.pem", "no-key.pem"))
+}
+
+func TestListenAutoTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	cert := ts.TLS.Certificates[0]
+
+	app := New()
+	app.Use(func(c *Context) {
+		c.String(c.Request.Proto)
+	})
+	addr := freeAddr(t)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.ListenAutoTLS(addr, CertProviderFunc(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		}))
+	}()
+
+	client := ts.Client()
+	client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	resp, err := get(client, "https://"+addr)
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	assert.Nil(t, app.Shutdown(context.Background()))
+	assert.Nil(t, <-errc)
+}
+
+func TestListenH2C(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.String(c.Request.Proto)
+	})
+	addr := freeAddr(t)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.ListenH2C(addr)
+	}()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	resp, err := get(client, "http://"+addr)
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	assert.Nil(t, app.Shutdown(context.Background()))
+	assert.Nil(t, <-errc)
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goa")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "goa.sock")
+
+	app := New()
+	app.Use(func(c *Context) {
+		c.String("unix")
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.ListenUnix(path, 0600)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", path)
+			},
+		},
+	}
+	resp, err := get(client, "http://unix")
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "unix", string(body))
+	}
+
+	info, err := os.Stat(path)
+	if assert.Nil(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	assert.Nil(t, app.Shutdown(context.Background()))
+	assert.Nil(t, <-errc)
+}
+
+func TestServe(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {
+		c.String("listener")
+	})
+	addr, errc := startServer(t, app)
+
+	resp, err := http.Get("http://" + addr)
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "listener", string(body))
+	}
+
+	assert.Nil(t, app.Shutdown(context.Background()))
+	assert.Nil(t, <-errc)
+}
+
+func TestServerClose(t *testing.T) {
+	app := New()
+	app.Use(func(c *Context) {})
+	_, errc := startServer(t, app)
+
+	assert.Nil(t, app.Server().Close())
+	select {
+	case err := <-errc:
+		assert.Equal(t, http.ErrServerClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("app.Serve is not unblocked by app.Server().Close()")
+	}
+}
+
+func TestListenFD(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	f, err := l.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.Nil(t, err)
+	f.Close()
+	l.Close()
+
+	app := New()
+	app.Use(func(c *Context) {
+		c.String("fd")
+	})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- app.ListenFD(uintptr(fd))
+	}()
+
+	resp, err := get(http.DefaultClient, "http://"+l.Addr().String())
+	if assert.Nil(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "fd", string(body))
+	}
+
+	assert.Nil(t, app.Shutdown(context.Background()))
+	assert.Nil(t, <-errc)
+}
@@ -0,0 +1,210 @@
+package goa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errStreamClosed = errors.New("goa: the event stream is closed")
+
+// EventStream is a stream of Server-Sent Events started by c.SSE().
+// Its methods are safe to be called from multiple goroutines,
+// every message is flushed to the client at once.
+type EventStream struct {
+	ctx   context.Context
+	w     http.ResponseWriter
+	mu    sync.Mutex
+	buf   []byte
+	close chan struct{}
+	err   error
+}
+
+// SSE starts a Server-Sent Events stream, the headers are sent immediately.
+// The response is marked handled, so the stream is the whole body.
+// It's closed when the middleware chain returns, the middleware should keep
+// sending until the client disconnects, i.e. stream.Done() is closed.
+// Note that goa.RequestTimeout ends the stream as well.
+// For example,
+// stream := c.SSE()
+// stream.Heartbeat(15 * time.Second)
+// for {
+//   select {
+//   case <-stream.Done():
+//     return
+//   case msg := <-messages:
+//     stream.Send("message", msg.ID, msg)
+//   }
+// }
+func (c *Context) SSE() *EventStream {
+	c.checkReleased()
+	if c.stream != nil {
+		return c.stream
+	}
+
+	c.Handled = true
+	c.SetHeader("Content-Type", "text/event-stream")
+	c.SetHeader("Cache-Control", "no-cache")
+	// disable the buffering of nginx
+	c.SetHeader("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+
+	c.stream = &EventStream{
+		ctx:   c.Request.Context(),
+		w:     c.ResponseWriter,
+		close: make(chan struct{}),
+	}
+	c.stream.flush()
+	return c.stream
+}
+
+// Send sends an event, the event name and id are omitted if they are empty.
+// data of string or []byte is sent as it is, multiple lines are sent as multiple data fields,
+// any other value is encoded as JSON.
+// It returns an error if the client has disconnected or the stream is closed.
+func (s *EventStream) Send(event, id string, data interface{}) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return errors.New("goa: the event name and id can't contain line breaks")
+	}
+
+	var b []byte
+	switch d := data.(type) {
+	case string:
+		b = []byte(d)
+	case []byte:
+		b = d
+	default:
+		var err error
+		if b, err = json.Marshal(d); err != nil {
+			return err
+		}
+	}
+
+	return s.write(func(buf []byte) []byte {
+		if id != "" {
+			buf = append(buf, "id: "...)
+			buf = append(buf, id...)
+			buf = append(buf, '\n')
+		}
+		if event != "" {
+			buf = append(buf, "event: "...)
+			buf = append(buf, event...)
+			buf = append(buf, '\n')
+		}
+		buf = appendLines(buf, "data:", b)
+		return append(buf, '\n')
+	})
+}
+
+// Retry tells the client to reconnect after d when the connection is lost.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write(func(buf []byte) []byte {
+		buf = append(buf, "retry: "...)
+		buf = strconv.AppendInt(buf, d.Milliseconds(), 10)
+		return append(buf, "\n\n"...)
+	})
+}
+
+// Comment sends a comment, which is ignored by the client.
+func (s *EventStream) Comment(text string) error {
+	return s.write(func(buf []byte) []byte {
+		buf = appendLines(buf, ":", []byte(text))
+		return append(buf, '\n')
+	})
+}
+
+// Heartbeat sends a comment every interval in the background until the stream is closed,
+// which keeps the connection alive through proxies.
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			case <-s.close:
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Done returns a channel which is closed when the client disconnects or the request times out.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Err returns the error of the request context, e.g. context.Canceled after the client disconnects.
+func (s *EventStream) Err() error {
+	return s.ctx.Err()
+}
+
+// Close closes the stream and stops the heartbeat, nothing can be sent after that.
+// goa closes the stream when the middleware chain returns.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = errStreamClosed
+		close(s.close)
+	}
+}
+
+func (s *EventStream) write(message func([]byte) []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	s.buf = message(s.buf[:0])
+	if _, err := s.w.Write(s.buf); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *EventStream) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// appendLines appends every line of text with the field name,
+// "\r\n", "\r" and "\n" are all line breaks.
+func appendLines(buf []byte, field string, text []byte) []byte {
+	for {
+		i := 0
+		for i < len(text) && text[i] != '\n' && text[i] != '\r' {
+			i++
+		}
+		buf = append(buf, field...)
+		if field != ":" || i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, text[:i]...)
+		buf = append(buf, '\n')
+		if i == len(text) {
+			return buf
+		}
+		if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+			i++
+		}
+		text = text[i+1:]
+	}
+}
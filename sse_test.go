@@ -0,0 +1,125 @@
+package goa
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSE(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		stream := c.SSE()
+		assert.Same(t, stream, c.SSE())
+		assert.Nil(t, stream.Retry(3*time.Second))
+		assert.Nil(t, stream.Send("", "", "hello"))
+		assert.Nil(t, stream.Send("update", "1", M{"key": "value"}))
+		assert.Nil(t, stream.Send("lines", "", "a\nb\r\nc"))
+		assert.Nil(t, stream.Comment("comment"))
+		assert.Error(t, stream.Send("bad\nevent", "", ""))
+	})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "retry: 3000\n\n"+
+		"data: hello\n\n"+
+		"id: 1\nevent: update\ndata: {\"key\":\"value\"}\n\n"+
+		"event: lines\ndata: a\ndata: b\ndata: c\n\n"+
+		": comment\n\n", string(body))
+}
+
+func TestSSEFlush(t *testing.T) {
+	next := make(chan struct{})
+	ts := testServer(func(c *Context) {
+		c.Response().Buffer()
+		stream := c.SSE()
+		stream.Send("", "", "first")
+		<-next
+		stream.Send("", "", "second")
+	})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	line, _ := r.ReadString('\n')
+	assert.Equal(t, "data: first\n", line)
+	close(next)
+	r.ReadString('\n')
+	line, _ = r.ReadString('\n')
+	assert.Equal(t, "data: second\n", line)
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	ts := testServer(func(c *Context) {
+		stream := c.SSE()
+		stream.Heartbeat(10 * time.Millisecond)
+		<-stream.Done()
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Equal(t, ": heartbeat\n", line)
+	cancel()
+}
+
+func TestSSEDisconnect(t *testing.T) {
+	done := make(chan error, 1)
+	ts := testServer(func(c *Context) {
+		stream := c.SSE()
+		<-stream.Done()
+		done <- stream.Send("", "", "gone")
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("the disconnect is not detected")
+	}
+}
+
+func TestSSEClose(t *testing.T) {
+	var stream *EventStream
+	ts := testServer(func(c *Context) {
+		stream = c.SSE()
+		stream.Heartbeat(time.Millisecond)
+	})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, errStreamClosed, stream.Send("", "", "closed"))
+	assert.False(t, strings.Contains(string(body), "closed"))
+}
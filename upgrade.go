@@ -0,0 +1,50 @@
+package goa
+
+import (
+	"net/http"
+
+	"github.com/goa-go/goa/websocket"
+)
+
+// Upgrade upgrades the connection to the WebSocket protocol with app.Upgrader,
+// the upstream middlewares, e.g. authentication, have run before it.
+// The response is marked handled, the connection should be used and closed by the caller.
+// It returns goa.Error with the status code if the request is not a valid handshake.
+// For example,
+// app.UseErr(func(c *goa.Context) error {
+//   conn, err := c.Upgrade()
+//   if err != nil {
+//     return err
+//   }
+//   defer conn.Close()
+//   for {
+//     t, msg, err := conn.ReadMessage()
+//     if err != nil {
+//       return nil
+//     }
+//     conn.WriteMessage(t, msg)
+//   }
+// })
+func (c *Context) Upgrade() (*websocket.Conn, error) {
+	c.checkReleased()
+
+	var u websocket.Upgrader
+	if c.app != nil {
+		u = c.app.Upgrader
+	}
+	conn, err := u.Upgrade(c.ResponseWriter, c.Request)
+	if err != nil {
+		if e, ok := err.(websocket.HandshakeError); ok {
+			err = Error{
+				Code:  e.Code,
+				Msg:   e.Msg,
+				Cause: err,
+			}
+		}
+		return nil, err
+	}
+
+	c.Handled = true
+	c.Status(http.StatusSwitchingProtocols)
+	return conn, nil
+}
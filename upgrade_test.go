@@ -0,0 +1,67 @@
+package goa
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upgradeRequest(t *testing.T, ts *httptest.Server, token string) *http.Response {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate")
+	req.Header.Set("Authorization", token)
+	assert.Nil(t, req.Write(conn))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestUpgrade(t *testing.T) {
+	app := New()
+	app.Upgrader.EnableCompression = true
+	app.Use(func(c *Context) {
+		if c.Header.Get("Authorization") != "secret" {
+			c.Error(http.StatusUnauthorized, "unauthorized")
+		}
+		c.Next()
+	})
+	app.UseErr(func(c *Context) error {
+		conn, err := c.Upgrade()
+		if err != nil {
+			return err
+		}
+		assert.True(t, c.Handled)
+		assert.True(t, conn.Compressed())
+		return conn.Close()
+	})
+	ts := httptest.NewServer(app)
+	defer ts.Close()
+
+	resp := upgradeRequest(t, ts, "secret")
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Contains(t, resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+
+	resp = upgradeRequest(t, ts, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Authorization", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+// deflateTail is the empty stored block which ends a flushed deflate stream,
+// it's removed from compressed messages and appended before decompressing (RFC 7692 7.2).
+const deflateTail = "\x00\x00\xff\xff"
+
+var errReadLimit = errors.New("websocket: read limit exceeded")
+
+var (
+	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	writerPool sync.Pool
+	readerPool sync.Pool
+)
+
+func putBuffer(b *bytes.Buffer) {
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// compress compresses data without context takeover,
+// the returned buffer should be put back by putBuffer.
+func compress(data []byte) (*bytes.Buffer, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	w, _ := writerPool.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(b, flate.DefaultCompression)
+	} else {
+		w.Reset(b)
+	}
+	defer writerPool.Put(w)
+
+	if _, err := w.Write(data); err != nil {
+		putBuffer(b)
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		putBuffer(b)
+		return nil, err
+	}
+	b.Truncate(b.Len() - len(deflateTail))
+	return b, nil
+}
+
+// decompress decompresses a message, whose size can't exceed limit.
+func decompress(data []byte, limit int64) ([]byte, error) {
+	src := io.MultiReader(
+		bytes.NewReader(data),
+		// the final empty block stops the reader at the end of the message
+		bytes.NewReader([]byte(deflateTail+"\x01\x00\x00\xff\xff")),
+	)
+	r, _ := readerPool.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(src)
+	} else {
+		r.(flate.Resetter).Reset(src, nil)
+	}
+	defer readerPool.Put(r)
+
+	var b bytes.Buffer
+	n, err := b.ReadFrom(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, errReadLimit
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,373 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxControlPayload is the maximum payload size of control frames.
+const maxControlPayload = 125
+
+// Conn is a WebSocket connection.
+// Messages should be read from one goroutine at a time,
+// writing is safe from multiple goroutines.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	subprotocol string
+	compress    bool
+	readLimit   int64
+
+	// read state
+	readErr     error
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+	header      [8]byte
+
+	// write state
+	mu        sync.Mutex
+	bw        *bufio.Writer
+	closeSent bool
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, bw *bufio.Writer, subprotocol string, compress bool, readLimit int64) *Conn {
+	c := &Conn{
+		conn:        conn,
+		br:          br,
+		bw:          bw,
+		subprotocol: subprotocol,
+		compress:    compress,
+		readLimit:   readLimit,
+	}
+	c.pingHandler = c.pong
+	c.pongHandler = func([]byte) error { return nil }
+	return c
+}
+
+// Subprotocol returns the subprotocol selected in the handshake.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed reports whether the permessage-deflate extension is negotiated.
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of reading, e.g. to detect dead clients with pings.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of writing.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler of the ping frames received while reading,
+// the default one replies a pong frame with the same data.
+func (c *Conn) SetPingHandler(h func(data []byte) error) {
+	if h == nil {
+		h = c.pong
+	}
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the handler of the pong frames received while reading,
+// the default one does nothing.
+func (c *Conn) SetPongHandler(h func(data []byte) error) {
+	if h == nil {
+		h = func([]byte) error { return nil }
+	}
+	c.pongHandler = h
+}
+
+func (c *Conn) pong(data []byte) error {
+	err := c.WriteMessage(PongMessage, data)
+	if err == ErrCloseSent {
+		return nil
+	}
+	return err
+}
+
+// Close closes the underlying connection without the close handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// WriteClose sends a close frame with the code and reason,
+// nothing can be written after that.
+// A graceful close waits for the close frame of the client by reading until a *CloseError is returned.
+func (c *Conn) WriteClose(code int, reason string) error {
+	return c.WriteMessage(CloseMessage, closePayload(code, reason))
+}
+
+// WriteMessage writes a message of the type,
+// text and binary messages are compressed if permessage-deflate is negotiated.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return errors.New("websocket: the payload of a control frame is too large")
+		}
+	default:
+		return errors.New("websocket: unknown message type")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+
+	var b0 byte = 0x80 | byte(messageType)
+	if c.compress && (messageType == TextMessage || messageType == BinaryMessage) {
+		compressed, err := compress(data)
+		if err != nil {
+			return err
+		}
+		defer putBuffer(compressed)
+		data = compressed.Bytes()
+		b0 |= 0x40
+	}
+
+	var header [10]byte
+	header[0] = b0
+	n := 2
+	switch l := len(data); {
+	case l <= 125:
+		header[1] = byte(l)
+	case l <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(l))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(l))
+		n += 8
+	}
+
+	c.bw.Write(header[:n])
+	c.bw.Write(data)
+	return c.bw.Flush()
+}
+
+// ReadMessage reads the next text or binary message.
+// Ping and pong frames are passed to their handlers while reading.
+// When a close frame is received, the close frame is replied and a *CloseError is returned,
+// on protocol errors the connection is closed with the corresponding close code.
+// Once an error is returned, the following calls return the same error.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, data, err = c.readMessage()
+	if err != nil {
+		c.readErr = err
+		// the close frame is replied already if it's received
+		if e, ok := err.(*CloseError); ok {
+			c.WriteClose(e.Code, e.Text)
+			c.conn.Close()
+		}
+	}
+	return
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	var (
+		messageType int
+		compressed  bool
+		message     []byte
+	)
+
+	for {
+		fin, rsv1, op, payload, err := c.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case PingMessage:
+			if err := c.pingHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if err := c.pongHandler(payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, protocolError("a new message starts before the last one ends")
+			}
+			if rsv1 && !c.compress {
+				return 0, nil, protocolError("RSV1 is set without compression")
+			}
+			messageType = int(op)
+			compressed = rsv1
+		default: // continuation
+			if messageType == 0 {
+				return 0, nil, protocolError("continuation frame without a message")
+			}
+			if rsv1 {
+				return 0, nil, protocolError("RSV1 is set on a continuation frame")
+			}
+		}
+
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			if message, err = decompress(message, c.readLimit); err != nil {
+				if err == errReadLimit {
+					return 0, nil, &CloseError{CloseMessageTooBig, "message too big"}
+				}
+				return 0, nil, &CloseError{CloseInvalidFramePayloadData, "invalid compressed data"}
+			}
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, &CloseError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"}
+		}
+		return messageType, message, nil
+	}
+}
+
+// readFrame reads a frame, read is the size of the message read before it.
+func (c *Conn) readFrame(read int64) (fin, rsv1 bool, op byte, payload []byte, err error) {
+	h := c.header[:2]
+	if _, err = io.ReadFull(c.br, h); err != nil {
+		return
+	}
+	fin = h[0]&0x80 != 0
+	rsv1 = h[0]&0x40 != 0
+	op = h[0] & 0x0f
+	masked := h[1]&0x80 != 0
+	length := int64(h[1] & 0x7f)
+
+	switch {
+	case h[0]&0x30 != 0:
+		err = protocolError("RSV2 or RSV3 is set")
+	case op >= CloseMessage && op <= PongMessage:
+		if !fin || length > maxControlPayload || rsv1 {
+			err = protocolError("invalid control frame")
+		}
+	case op > BinaryMessage:
+		err = protocolError("unknown opcode")
+	}
+	if err == nil && !masked {
+		err = protocolError("the frame from the client is not masked")
+	}
+	if err != nil {
+		return
+	}
+
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(c.br, c.header[:2]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(c.header[:2]))
+	case 127:
+		if _, err = io.ReadFull(c.br, c.header[:8]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(c.header[:8]))
+		if length < 0 {
+			err = protocolError("invalid payload length")
+			return
+		}
+	}
+	if op < CloseMessage && length > c.readLimit-read {
+		err = &CloseError{CloseMessageTooBig, "message too big"}
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+// handleClose replies the close frame and returns the *CloseError.
+func (c *Conn) handleClose(payload []byte) error {
+	e := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return protocolError("invalid close payload")
+	case len(payload) >= 2:
+		e.Code = int(binary.BigEndian.Uint16(payload))
+		e.Text = string(payload[2:])
+		if !validCloseCode(e.Code) {
+			return protocolError("invalid close code")
+		}
+		if !utf8.ValidString(e.Text) {
+			return &CloseError{CloseInvalidFramePayloadData, "invalid UTF-8 in close reason"}
+		}
+	}
+
+	reply := []byte(nil)
+	if e.Code != CloseNoStatusReceived {
+		reply = closePayload(e.Code, "")
+	}
+	if err := c.WriteMessage(CloseMessage, reply); err != nil && err != ErrCloseSent {
+		return err
+	}
+	return e
+}
+
+func closePayload(code int, reason string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	b := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	return append(b, reason...)
+}
+
+// validCloseCode reports whether code can be sent in a close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func protocolError(text string) error {
+	return &CloseError{CloseProtocolError, text}
+}
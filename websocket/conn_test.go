@@ -0,0 +1,203 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFrame writes a masked frame like a client.
+func (c *client) writeFrame(t *testing.T, b0 byte, payload []byte) {
+	mask := [4]byte{1, 2, 3, 4}
+	var b bytes.Buffer
+	b.WriteByte(b0)
+	switch n := len(payload); {
+	case n <= 125:
+		b.WriteByte(0x80 | byte(n))
+	case n <= 0xffff:
+		b.WriteByte(0x80 | 126)
+		binary.Write(&b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0x80 | 127)
+		binary.Write(&b, binary.BigEndian, uint64(n))
+	}
+	b.Write(mask[:])
+	for i, v := range payload {
+		b.WriteByte(v ^ mask[i&3])
+	}
+	_, err := c.Write(b.Bytes())
+	assert.Nil(t, err)
+}
+
+// readFrame reads an unmasked frame like a client.
+func (c *client) readFrame(t *testing.T) (b0 byte, payload []byte) {
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	h := make([]byte, 2)
+	_, err := io.ReadFull(c.br, h)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0), h[1]&0x80, "the frame from the server is masked")
+
+	n := int(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var l uint16
+		binary.Read(c.br, binary.BigEndian, &l)
+		n = int(l)
+	case 127:
+		var l uint64
+		binary.Read(c.br, binary.BigEndian, &l)
+		n = int(l)
+	}
+	payload = make([]byte, n)
+	_, err = io.ReadFull(c.br, payload)
+	assert.Nil(t, err)
+	return h[0], payload
+}
+
+// readClose reads a close frame and returns its code.
+func (c *client) readClose(t *testing.T) int {
+	b0, payload := c.readFrame(t)
+	assert.Equal(t, byte(0x80|CloseMessage), b0)
+	if len(payload) < 2 {
+		return CloseNoStatusReceived
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func TestEcho(t *testing.T) {
+	ts := echoServer(&Upgrader{})
+	defer ts.Close()
+	c, _ := dial(t, ts, nil)
+	defer c.Close()
+
+	c.writeFrame(t, 0x80|TextMessage, []byte("Hello Goa!"))
+	b0, payload := c.readFrame(t)
+	assert.Equal(t, byte(0x80|TextMessage), b0)
+	assert.Equal(t, "Hello Goa!", string(payload))
+
+	large := bytes.Repeat([]byte{0xff}, 70000)
+	c.writeFrame(t, 0x80|BinaryMessage, large)
+	b0, payload = c.readFrame(t)
+	assert.Equal(t, byte(0x80|BinaryMessage), b0)
+	assert.Equal(t, large, payload)
+
+	// fragmented with a ping between the fragments
+	c.writeFrame(t, TextMessage, []byte("frag"))
+	c.writeFrame(t, 0x80|PingMessage, []byte("ping"))
+	c.writeFrame(t, 0x80, []byte("ment"))
+	b0, payload = c.readFrame(t)
+	assert.Equal(t, byte(0x80|PongMessage), b0)
+	assert.Equal(t, "ping", string(payload))
+	_, payload = c.readFrame(t)
+	assert.Equal(t, "fragment", string(payload))
+
+	// close handshake
+	c.writeFrame(t, 0x80|CloseMessage, closePayload(CloseGoingAway, "bye"))
+	assert.Equal(t, CloseGoingAway, c.readClose(t))
+}
+
+func TestCompression(t *testing.T) {
+	ts := echoServer(&Upgrader{EnableCompression: true})
+	defer ts.Close()
+	c, resp := dial(t, ts, map[string]string{"Sec-WebSocket-Extensions": "permessage-deflate; client_max_window_bits"})
+	defer c.Close()
+	assert.Equal(t, "permessage-deflate; server_no_context_takeover; client_no_context_takeover",
+		resp.Header.Get("Sec-WebSocket-Extensions"))
+
+	text := strings.Repeat("Hello Goa! ", 100)
+	compressed, _ := compress([]byte(text))
+	c.writeFrame(t, 0xc0|TextMessage, compressed.Bytes())
+
+	b0, payload := c.readFrame(t)
+	assert.Equal(t, byte(0xc0|TextMessage), b0)
+	assert.True(t, len(payload) < len(text))
+	decompressed, err := decompress(payload, defaultReadLimit)
+	assert.Nil(t, err)
+	assert.Equal(t, text, string(decompressed))
+
+	// uncompressed messages are allowed as well
+	c.writeFrame(t, 0x80|TextMessage, []byte("plain"))
+	_, payload = c.readFrame(t)
+	decompressed, _ = decompress(payload, defaultReadLimit)
+	assert.Equal(t, "plain", string(decompressed))
+}
+
+func TestProtocolError(t *testing.T) {
+	cases := []struct {
+		name string
+		send func(c *client)
+		code int
+	}{
+		{"unmasked", func(c *client) { c.Write([]byte{0x81, 0x01, 'a'}) }, CloseProtocolError},
+		{"rsv2", func(c *client) { c.writeFrame(t, 0xa0|TextMessage, nil) }, CloseProtocolError},
+		{"rsv1 without compression", func(c *client) { c.writeFrame(t, 0xc0|TextMessage, nil) }, CloseProtocolError},
+		{"unknown opcode", func(c *client) { c.writeFrame(t, 0x83, nil) }, CloseProtocolError},
+		{"fragmented ping", func(c *client) { c.writeFrame(t, PingMessage, nil) }, CloseProtocolError},
+		{"large ping", func(c *client) { c.writeFrame(t, 0x80|PingMessage, make([]byte, 126)) }, CloseProtocolError},
+		{"continuation", func(c *client) { c.writeFrame(t, 0x80, []byte("a")) }, CloseProtocolError},
+		{"new message", func(c *client) {
+			c.writeFrame(t, TextMessage, []byte("a"))
+			c.writeFrame(t, 0x80|TextMessage, []byte("b"))
+		}, CloseProtocolError},
+		{"invalid utf-8", func(c *client) { c.writeFrame(t, 0x80|TextMessage, []byte{0xff}) }, CloseInvalidFramePayloadData},
+		{"invalid close code", func(c *client) { c.writeFrame(t, 0x80|CloseMessage, closePayload(1004, "")) }, CloseProtocolError},
+		{"too big", func(c *client) { c.writeFrame(t, 0x80|BinaryMessage, make([]byte, 1025)) }, CloseMessageTooBig},
+	}
+
+	ts := echoServer(&Upgrader{ReadLimit: 1024})
+	defer ts.Close()
+	for _, tc := range cases {
+		c, _ := dial(t, ts, nil)
+		tc.send(c)
+		assert.Equal(t, tc.code, c.readClose(t), tc.name)
+		c.Close()
+	}
+}
+
+func TestWriteClose(t *testing.T) {
+	done := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := (&Upgrader{}).Upgrade(w, r)
+		defer conn.Close()
+
+		assert.Nil(t, conn.WriteMessage(PingMessage, []byte("ping")))
+		assert.Nil(t, conn.WriteClose(CloseNormalClosure, "done"))
+		assert.Equal(t, ErrCloseSent, conn.WriteMessage(TextMessage, []byte("late")))
+		_, _, err := conn.ReadMessage()
+		done <- err
+	}))
+	defer ts.Close()
+	c, _ := dial(t, ts, nil)
+	defer c.Close()
+
+	b0, payload := c.readFrame(t)
+	assert.Equal(t, byte(0x80|PingMessage), b0)
+	assert.Equal(t, "ping", string(payload))
+	_, payload = c.readFrame(t)
+	assert.Equal(t, closePayload(CloseNormalClosure, "done"), payload)
+
+	c.writeFrame(t, 0x80|PongMessage, []byte("ping"))
+	c.writeFrame(t, 0x80|CloseMessage, closePayload(CloseNormalClosure, ""))
+	err := <-done
+	assert.True(t, IsCloseError(err, CloseNormalClosure))
+	assert.EqualError(t, err, "websocket: close 1000 ")
+}
+
+func TestWriteMessageInvalid(t *testing.T) {
+	c := &Conn{}
+	assert.Error(t, c.WriteMessage(3, nil))
+	assert.Error(t, c.WriteMessage(PingMessage, make([]byte, 126)))
+}
+
+func TestDecompressLimit(t *testing.T) {
+	compressed, _ := compress(make([]byte, 2048))
+	_, err := decompress(compressed.Bytes(), 1024)
+	assert.Equal(t, errReadLimit, err)
+}
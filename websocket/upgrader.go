@@ -0,0 +1,198 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultReadLimit is the maximum size of a message read by default, 32MB.
+const defaultReadLimit = 32 << 20
+
+// Upgrader is the options of the WebSocket handshake.
+type Upgrader struct {
+	// Subprotocols are the protocols supported by the server in order of preference,
+	// the first one requested by the client is selected.
+	Subprotocols []string
+
+	// CheckOrigin reports whether the origin of the request is acceptable,
+	// if nil, the host of Origin must be the same as the host of the request.
+	CheckOrigin func(r *http.Request) bool
+
+	// EnableCompression negotiates the permessage-deflate extension,
+	// messages are compressed if the client supports it.
+	EnableCompression bool
+
+	// ReadLimit is the maximum size of a message read, 32MB by default.
+	// The connection is closed with CloseMessageTooBig if it's exceeded.
+	ReadLimit int64
+}
+
+// Upgrade upgrades the HTTP connection to the WebSocket protocol.
+// The headers set on w are sent with the handshake response, e.g. Set-Cookie.
+// If the handshake fails, a HandshakeError is returned and nothing is written,
+// the caller should respond the error.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, HandshakeError{http.StatusMethodNotAllowed, "the method is not GET"}
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") {
+		return nil, HandshakeError{http.StatusBadRequest, "'upgrade' token not found in 'Connection' header"}
+	}
+	if !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, HandshakeError{http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header"}
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, HandshakeError{http.StatusUpgradeRequired, "unsupported version"}
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, HandshakeError{http.StatusBadRequest, "invalid 'Sec-WebSocket-Key' header"}
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, HandshakeError{http.StatusForbidden, "origin not allowed"}
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, HandshakeError{http.StatusInternalServerError, "the ResponseWriter doesn't implement http.Hijacker"}
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+	compress := u.EnableCompression && negotiateDeflate(r.Header)
+
+	netConn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, HandshakeError{http.StatusBadRequest, "the client sent data before the handshake is complete"}
+	}
+	// clear the deadlines set by http.Server
+	netConn.SetDeadline(time.Time{})
+
+	bw := bufio.NewWriter(netConn)
+	bw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	bw.WriteString(acceptKey(key))
+	bw.WriteString("\r\n")
+	if subprotocol != "" {
+		bw.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		bw.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	for k, values := range w.Header() {
+		if k == "Sec-Websocket-Protocol" || k == "Sec-Websocket-Extensions" {
+			continue
+		}
+		for _, v := range values {
+			bw.WriteString(k + ": " + strings.NewReplacer("\r", " ", "\n", " ").Replace(v) + "\r\n")
+		}
+	}
+	bw.WriteString("\r\n")
+	if err := bw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	readLimit := u.ReadLimit
+	if readLimit <= 0 {
+		readLimit = defaultReadLimit
+	}
+	return newConn(netConn, brw.Reader, bw, subprotocol, compress, readLimit), nil
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	requested := headerTokens(r.Header, "Sec-Websocket-Protocol")
+	for _, p := range u.Subprotocols {
+		for _, q := range requested {
+			if p == q {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// sameOrigin reports whether the request has no Origin header,
+// or the host of Origin is the host of the request.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// negotiateDeflate reports whether an acceptable permessage-deflate offer exists.
+// Contexts are never taken over, so the only unacceptable parameter is
+// server_max_window_bits less than 15, which flate doesn't support.
+func negotiateDeflate(header http.Header) bool {
+	for _, offer := range headerTokens(header, "Sec-Websocket-Extensions") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+		ok := true
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch strings.TrimSpace(name) {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				bits, err := strconv.Atoi(strings.Trim(strings.TrimSpace(value), `"`))
+				ok = ok && err == nil && bits == 15
+			default:
+				ok = false
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTokens returns the comma-separated values of the header.
+func headerTokens(header http.Header, key string) []string {
+	var tokens []string
+	for _, value := range header[key] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContains(header http.Header, key, token string) bool {
+	for _, t := range headerTokens(header, key) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
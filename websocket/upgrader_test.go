@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// echoServer echoes the messages until the connection is closed.
+func echoServer(u *Upgrader) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Custom", "custom")
+		conn, err := u.Upgrade(w, r)
+		if err != nil {
+			e := err.(HandshakeError)
+			http.Error(w, e.Msg, e.Code)
+			return
+		}
+		defer conn.Close()
+		for {
+			t, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(t, msg)
+		}
+	}))
+}
+
+type client struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+// dial sends the handshake request with the extra headers.
+func dial(t *testing.T, ts *httptest.Server, header map[string]string) (*client, *http.Response) {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", testKey)
+	for k, v := range header {
+		if v == "" {
+			req.Header.Del(k)
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+	assert.Nil(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	assert.Nil(t, err)
+	return &client{conn, br}, resp
+}
+
+func TestUpgrade(t *testing.T) {
+	ts := echoServer(&Upgrader{Subprotocols: []string{"chat", "json"}})
+	defer ts.Close()
+
+	c, resp := dial(t, ts, map[string]string{
+		"Sec-WebSocket-Protocol": "json, chat",
+		"Origin":                 ts.URL,
+	})
+	defer c.Close()
+
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+	assert.Equal(t, "Upgrade", resp.Header.Get("Connection"))
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat", resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "", resp.Header.Get("Sec-WebSocket-Extensions"))
+	assert.Equal(t, "custom", resp.Header.Get("X-Custom"))
+}
+
+func TestUpgradeFailed(t *testing.T) {
+	ts := echoServer(&Upgrader{})
+	defer ts.Close()
+
+	cases := []struct {
+		header map[string]string
+		code   int
+	}{
+		{map[string]string{"Connection": "keep-alive"}, http.StatusBadRequest},
+		{map[string]string{"Upgrade": "h2c"}, http.StatusBadRequest},
+		{map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{map[string]string{"Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+		{map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest},
+		{map[string]string{"Origin": "http://evil.com"}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		c, resp := dial(t, ts, tc.header)
+		c.Close()
+		assert.Equal(t, tc.code, resp.StatusCode, "%v", tc.header)
+		if tc.code == http.StatusUpgradeRequired {
+			assert.Equal(t, "13", resp.Header.Get("Sec-WebSocket-Version"))
+		}
+	}
+
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader(""))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	ts := echoServer(&Upgrader{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://goa-go.github.io"
+	}})
+	defer ts.Close()
+
+	c, resp := dial(t, ts, map[string]string{"Origin": "https://goa-go.github.io"})
+	c.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	c, resp = dial(t, ts, map[string]string{"Origin": ts.URL})
+	c.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestNegotiateDeflate(t *testing.T) {
+	cases := map[string]bool{
+		"":                   false,
+		"permessage-deflate": true,
+		"x-webkit-deflate-frame, permessage-deflate; client_max_window_bits": true,
+		"permessage-deflate; server_max_window_bits=10":                      false,
+		"permessage-deflate; server_max_window_bits=10, permessage-deflate":  true,
+		"permessage-deflate; server_max_window_bits=15":                      true,
+		"permessage-deflate; unknown":                                        false,
+	}
+	for value, ok := range cases {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Sec-WebSocket-Extensions", value)
+		}
+		assert.Equal(t, ok, negotiateDeflate(header), value)
+	}
+}
@@ -0,0 +1,72 @@
+// Package websocket implements the server side of the WebSocket protocol (RFC 6455),
+// with the permessage-deflate extension (RFC 7692).
+// It's used by goa's c.Upgrade(), and works with any http.Handler as well.
+package websocket // import "github.com/goa-go/goa/websocket"
+
+import (
+	"errors"
+	"strconv"
+)
+
+// The message types, which are the opcodes of the frames.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// The close codes defined by RFC 6455.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// ErrCloseSent is returned when a message is written after the close frame is sent.
+var ErrCloseSent = errors.New("websocket: close sent")
+
+// HandshakeError is returned by Upgrader.Upgrade when the request is not a valid WebSocket handshake,
+// Code is the status code which should be responded.
+type HandshakeError struct {
+	Code int
+	Msg  string
+}
+
+func (e HandshakeError) Error() string {
+	return "websocket: " + e.Msg
+}
+
+// CloseError is returned by Conn.ReadMessage when a close frame is received,
+// or sent because of a protocol error.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// IsCloseError reports whether err is a *CloseError with one of the codes.
+func IsCloseError(err error, codes ...int) bool {
+	var e *CloseError
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, code := range codes {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}